@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dzonerzy/go-snap/snap"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+)
+
+const (
+	// chatConnectTimeout bounds the wait for the first token; chatStreamTimeout
+	// bounds the whole answer.
+	chatConnectTimeout = 45 * time.Second
+	chatStreamTimeout  = 3 * time.Minute
+)
+
+var errGenerationInterrupted = errors.New("generation interrupted")
+
+// streamView selects how a streaming answer is shown while it arrives.
+type streamView int
+
+const (
+	// streamSpinner shows a spinner with a character count, for answers that
+	// are parsed rather than read (JSON plans and findings).
+	streamSpinner streamView = iota
+	// streamPreview renders the text on stderr as it arrives and erases it
+	// once complete, for messages that are shown again for confirmation.
+	streamPreview
+)
+
+// streamChatCompletion streams the model's answer. A spinner runs until the
+// first token; after that onDelta, when set, receives the text as it arrives.
+// Ctrl-C stops the request and returns the partial answer together with
+// errGenerationInterrupted.
+func streamChatCompletion(parent context.Context, apiKey string, systemPrompt string, userPrompt string, view streamView, onDelta func(string)) (string, error) {
+	client := openai.NewClient(option.WithAPIKey(apiKey))
+
+	requestCtx, cancel := context.WithTimeout(parent, chatStreamTimeout)
+	defer cancel()
+
+	var interrupted, received atomic.Bool
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+	go func() {
+		select {
+		case <-interrupts:
+			interrupted.Store(true)
+			cancel()
+		case <-requestCtx.Done():
+		}
+	}()
+
+	connectTimer := time.AfterFunc(chatConnectTimeout, func() {
+		if !received.Load() {
+			cancel()
+		}
+	})
+	defer connectTimer.Stop()
+
+	warnIfOverBudget()
+
+	spinner := startSpinner(fmt.Sprintf("Asking %s", commitModelName))
+	var preview *streamPreviewer
+	defer func() {
+		spinner.stop()
+		preview.erase()
+	}()
+
+	params := chatCompletionParams(systemPrompt, userPrompt)
+	params.StreamOptions = openai.ChatCompletionStreamOptionsParam{IncludeUsage: openai.Bool(true)}
+
+	started := time.Now()
+	stream := client.Chat.Completions.NewStreaming(requestCtx, params)
+	defer stream.Close()
+
+	var (
+		content strings.Builder
+		usage   openai.CompletionUsage
+	)
+	for stream.Next() {
+		chunk := stream.Current()
+		if chunk.Usage.TotalTokens > 0 {
+			usage = chunk.Usage
+		}
+		for _, choice := range chunk.Choices {
+			delta := choice.Delta.Content
+			if delta == "" {
+				continue
+			}
+			received.Store(true)
+			content.WriteString(delta)
+
+			switch {
+			case onDelta != nil:
+				spinner.stop()
+				onDelta(delta)
+			case view == streamPreview && spinner.active():
+				spinner.stop()
+				preview = newStreamPreviewer()
+				preview.write(delta)
+			case view == streamPreview:
+				preview.write(delta)
+			default:
+				spinner.setStatus(fmt.Sprintf("%d chars", content.Len()))
+			}
+		}
+	}
+
+	record := usageRecord{
+		Time:             started,
+		Model:            commitModelName,
+		LatencyMS:        time.Since(started).Milliseconds(),
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+	}
+	text := strings.TrimSpace(content.String())
+
+	if interrupted.Load() {
+		record.Error = errGenerationInterrupted.Error()
+		recordModelUsage(record)
+		return text, errGenerationInterrupted
+	}
+	if err := stream.Err(); err != nil {
+		if !received.Load() && errors.Is(err, context.Canceled) && parent.Err() == nil {
+			err = fmt.Errorf("no response from %s within %s", commitModelName, chatConnectTimeout)
+		}
+		record.Error = err.Error()
+		recordModelUsage(record)
+		return text, err
+	}
+	recordModelUsage(record)
+
+	if text == "" {
+		return "", fmt.Errorf("model returned an empty response")
+	}
+	return text, nil
+}
+
+// offerPartialMessage handles a generation stopped with Ctrl-C: the partial
+// text is shown and can be finished in the editor. It returns "" when the
+// user declines or nothing was generated.
+func offerPartialMessage(ctx *snap.Context, partial string) (string, error) {
+	partial = strings.TrimSpace(partial)
+	if partial == "" {
+		fmt.Fprintln(ctx.Stderr(), "Generation interrupted before any text arrived.")
+		return "", nil
+	}
+
+	fmt.Fprintf(ctx.Stdout(), "Generation interrupted. Partial message:\n%s\n\n", partial)
+	fmt.Fprint(ctx.Stdout(), "Edit and use it? [y/n]: ")
+	choice, err := readConfirmationChoice(ctx)
+	fmt.Fprintln(ctx.Stdout())
+	if err != nil {
+		return "", fmt.Errorf("reading choice: %w", err)
+	}
+	if strings.ToLower(string(choice)) != "y" {
+		return "", nil
+	}
+
+	edited, err := editCommitMessage(ctx, partial)
+	if err != nil {
+		return "", fmt.Errorf("edit message: %w", err)
+	}
+	return strings.TrimSpace(edited), nil
+}
+
+type terminalSpinner struct {
+	label  string
+	mu     sync.Mutex
+	status string
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// startSpinner draws a spinner on stderr; it returns nil, which every method
+// accepts, when stderr is not a terminal.
+func startSpinner(label string) *terminalSpinner {
+	if !stderrIsTerminal() {
+		return nil
+	}
+
+	s := &terminalSpinner{label: label, done: make(chan struct{})}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		for frame := 0; ; frame++ {
+			s.mu.Lock()
+			status := s.status
+			s.mu.Unlock()
+			line := spinnerFrames[frame%len(spinnerFrames)] + " " + s.label + "..."
+			if status != "" {
+				line += " " + status
+			}
+			fmt.Fprint(os.Stderr, "\r\x1b[2K"+line)
+
+			select {
+			case <-s.done:
+				fmt.Fprint(os.Stderr, "\r\x1b[2K")
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return s
+}
+
+func (s *terminalSpinner) active() bool {
+	if s == nil {
+		return false
+	}
+	select {
+	case <-s.done:
+		return false
+	default:
+		return true
+	}
+}
+
+func (s *terminalSpinner) setStatus(status string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.status = status
+	s.mu.Unlock()
+}
+
+func (s *terminalSpinner) stop() {
+	if !s.active() {
+		return
+	}
+	close(s.done)
+	s.wg.Wait()
+}
+
+// streamPreviewer echoes streamed text to stderr and can erase it again.
+type streamPreviewer struct {
+	width int
+	text  strings.Builder
+}
+
+func newStreamPreviewer() *streamPreviewer {
+	return &streamPreviewer{width: terminalWidth()}
+}
+
+func (p *streamPreviewer) write(delta string) {
+	if p == nil {
+		return
+	}
+	p.text.WriteString(delta)
+	fmt.Fprint(os.Stderr, strings.ReplaceAll(delta, "\n", "\r\n"))
+}
+
+func (p *streamPreviewer) erase() {
+	if p == nil || p.text.Len() == 0 {
+		return
+	}
+	rows := 0
+	for _, line := range strings.Split(p.text.String(), "\n") {
+		if n := len([]rune(line)); n > 0 {
+			rows += (n + p.width - 1) / p.width
+		} else {
+			rows++
+		}
+	}
+	if rows > 1 {
+		fmt.Fprintf(os.Stderr, "\r\x1b[%dA", rows-1)
+	}
+	fmt.Fprint(os.Stderr, "\r\x1b[J")
+	p.text.Reset()
+}
+
+func stderrIsTerminal() bool {
+	info, err := os.Stderr.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func terminalWidth() int {
+	cmd := exec.Command("stty", "size")
+	cmd.Stdin = os.Stdin
+	if out, err := cmd.Output(); err == nil {
+		fields := strings.Fields(string(out))
+		if len(fields) == 2 {
+			if width, err := strconv.Atoi(fields[1]); err == nil && width > 0 {
+				return width
+			}
+		}
+	}
+	return 80
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/ktr0731/go-fuzzyfinder"
+)
+
+type checkoutBranch struct {
+	ref     string
+	name    string
+	remote  bool
+	when    string
+	author  string
+	subject string
+}
+
+// pickCheckoutBranch lets the user fuzzy-find a local or remote-tracking
+// branch, newest commit first. It returns nil when aborted.
+func pickCheckoutBranch() (*checkoutBranch, error) {
+	branches, err := listCheckoutBranches()
+	if err != nil {
+		return nil, err
+	}
+	if len(branches) == 0 {
+		return nil, fmt.Errorf("no branches found; pass a branch name or GitHub URL")
+	}
+
+	base := pickerBaseRef()
+	var (
+		mu     sync.Mutex
+		counts = map[string]string{}
+	)
+	aheadBehind := func(ref string) string {
+		mu.Lock()
+		defer mu.Unlock()
+		if summary, ok := counts[ref]; ok {
+			return summary
+		}
+		summary := ""
+		if base != "" {
+			if out, err := gitOutput("rev-list", "--left-right", "--count", base+"..."+ref); err == nil {
+				if fields := strings.Fields(out); len(fields) == 2 {
+					summary = fmt.Sprintf("%s ahead, %s behind %s", fields[1], fields[0], base)
+				}
+			}
+		}
+		counts[ref] = summary
+		return summary
+	}
+
+	idx, err := fuzzyfinder.Find(
+		branches,
+		func(i int) string {
+			b := branches[i]
+			if b.remote {
+				return b.name + "  (remote)"
+			}
+			return b.name
+		},
+		fuzzyfinder.WithPromptString("gitCheckout> "),
+		fuzzyfinder.WithPreviewWindow(func(i, width, height int) string {
+			if i < 0 {
+				return ""
+			}
+			b := branches[i]
+			var preview strings.Builder
+			fmt.Fprintf(&preview, "%s\n\n%s\n%s, %s\n", b.name, b.subject, b.author, b.when)
+			if summary := aheadBehind(b.ref); summary != "" {
+				fmt.Fprintf(&preview, "\n%s\n", summary)
+			}
+			return preview.String()
+		}),
+	)
+	if err != nil {
+		if errors.Is(err, fuzzyfinder.ErrAbort) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("select branch: %w", err)
+	}
+	return &branches[idx], nil
+}
+
+// listCheckoutBranches returns local and remote-tracking branches sorted by
+// the date of their last commit, newest first.
+func listCheckoutBranches() ([]checkoutBranch, error) {
+	out, err := gitOutput("for-each-ref", "--sort=-committerdate",
+		"--format=%(refname)%00%(refname:short)%00%(committerdate:relative)%00%(authorname)%00%(subject)",
+		"refs/heads", "refs/remotes")
+	if err != nil {
+		return nil, err
+	}
+
+	var branches []checkoutBranch
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.SplitN(line, "\x00", 5)
+		if len(fields) != 5 || strings.HasSuffix(fields[0], "/HEAD") {
+			continue
+		}
+		branches = append(branches, checkoutBranch{
+			ref:     fields[0],
+			name:    fields[1],
+			remote:  strings.HasPrefix(fields[0], "refs/remotes/"),
+			when:    fields[2],
+			author:  fields[3],
+			subject: fields[4],
+		})
+	}
+	return branches, nil
+}
+
+// pickerBaseRef is the default branch the picker preview compares against,
+// preferring the remote copy.
+func pickerBaseRef() string {
+	base := detectBaseBranch("origin")
+	for _, ref := range []string{"origin/" + base, base} {
+		if ok, _ := gitRefExists(ref); ok {
+			return ref
+		}
+	}
+	return ""
+}
+
+func stdinIsTerminal() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,481 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dzonerzy/go-snap/snap"
+)
+
+const changelogFileName = "CHANGELOG.md"
+
+var (
+	changelogSections = []struct{ key, title string }{
+		{"breaking", "Breaking Changes"},
+		{"feat", "Features"},
+		{"fix", "Bug Fixes"},
+		{"perf", "Performance"},
+		{"refactor", "Refactoring"},
+		{"docs", "Documentation"},
+		{"test", "Tests"},
+		{"build", "Build and CI"},
+		{"chore", "Chores"},
+		{"other", "Other Changes"},
+	}
+	pullRequestRefPattern = regexp.MustCompile(`#(\d+)\b`)
+)
+
+type changelogEntry struct {
+	SHA         string `json:"sha"`
+	Subject     string `json:"subject"`
+	Type        string `json:"type"`
+	Scope       string `json:"scope,omitempty"`
+	Description string `json:"description"`
+	PullRequest []int  `json:"pull_requests,omitempty"`
+	Breaking    bool   `json:"breaking,omitempty"`
+}
+
+type changelogSection struct {
+	Type    string           `json:"type"`
+	Title   string           `json:"title"`
+	Entries []changelogEntry `json:"entries"`
+}
+
+type changelog struct {
+	Version  string             `json:"version"`
+	Date     string             `json:"date"`
+	From     string             `json:"from,omitempty"`
+	To       string             `json:"to"`
+	RepoURL  string             `json:"repo_url,omitempty"`
+	Sections []changelogSection `json:"sections"`
+}
+
+type changelogOptions struct {
+	from, to string
+	version  string
+	output   string
+	json     bool
+	offline  bool
+}
+
+func runChangelog(ctx *snap.Context) error {
+	usage := fmt.Sprintf("Usage: %s changelog [from..to] [--version <name>] [--output <file>] [--json] [--offline]", commandName)
+
+	var (
+		opts      changelogOptions
+		rangeSeen bool
+	)
+	for i := 0; i < ctx.NArgs(); i++ {
+		arg := strings.TrimSpace(ctx.Arg(i))
+		if arg == "" {
+			continue
+		}
+
+		switch {
+		case arg == "--json":
+			opts.json = true
+		case arg == "--offline":
+			opts.offline = true
+		case arg == "--version" || arg == "--output":
+			i++
+			if i >= ctx.NArgs() || strings.TrimSpace(ctx.Arg(i)) == "" {
+				fmt.Fprintln(ctx.Stderr(), usage)
+				return fmt.Errorf("%s requires a value", arg)
+			}
+			if arg == "--version" {
+				opts.version = strings.TrimSpace(ctx.Arg(i))
+			} else {
+				opts.output = strings.TrimSpace(ctx.Arg(i))
+			}
+		case strings.HasPrefix(arg, "--version="):
+			opts.version = strings.TrimSpace(strings.TrimPrefix(arg, "--version="))
+		case strings.HasPrefix(arg, "--output="):
+			opts.output = strings.TrimSpace(strings.TrimPrefix(arg, "--output="))
+		case strings.HasPrefix(arg, "--"):
+			fmt.Fprintln(ctx.Stderr(), usage)
+			return fmt.Errorf("unknown flag %q", arg)
+		case !rangeSeen:
+			rangeSeen = true
+			if from, to, ok := strings.Cut(arg, ".."); ok {
+				opts.from, opts.to = from, strings.TrimPrefix(to, ".")
+			} else {
+				opts.from = arg
+			}
+		default:
+			fmt.Fprintln(ctx.Stderr(), usage)
+			return fmt.Errorf("unexpected argument %q", arg)
+		}
+	}
+
+	if err := ensureGitRepository(); err != nil {
+		return reportError(ctx, err)
+	}
+
+	log, err := buildChangelog(ctx, opts)
+	if err != nil {
+		return reportError(ctx, err)
+	}
+
+	if opts.json {
+		data, err := json.MarshalIndent(log, "", "  ")
+		if err != nil {
+			return reportError(ctx, err)
+		}
+		fmt.Fprintln(ctx.Stdout(), string(data))
+		return nil
+	}
+
+	path, err := changelogPath(opts.output)
+	if err != nil {
+		return reportError(ctx, err)
+	}
+	if err := writeChangelogSection(path, log); err != nil {
+		return reportError(ctx, err)
+	}
+
+	fmt.Fprint(ctx.Stdout(), renderChangelogMarkdown(log))
+	fmt.Fprintf(ctx.Stdout(), "✔️ Wrote %s section to %s\n", log.Version, path)
+	return nil
+}
+
+func buildChangelog(ctx *snap.Context, opts changelogOptions) (*changelog, error) {
+	to := opts.to
+	if to == "" {
+		to = "HEAD"
+	}
+	if _, err := resolveCommitSHA(to); err != nil {
+		return nil, err
+	}
+
+	version := opts.version
+	from := opts.from
+	if from == "" {
+		start := to
+		if tag := exactTag(to); tag != "" {
+			if version == "" {
+				version = tag
+			}
+			start = to + "^"
+		}
+		if out, err := exec.Command("git", "describe", "--tags", "--abbrev=0", start).Output(); err == nil {
+			from = strings.TrimSpace(string(out))
+		}
+	} else if _, err := resolveCommitSHA(from); err != nil {
+		return nil, err
+	}
+	if version == "" {
+		if tag := exactTag(to); tag != "" {
+			version = tag
+		} else {
+			version = "Unreleased"
+		}
+	}
+
+	revRange := to
+	if from != "" {
+		revRange = from + ".." + to
+	}
+	out, err := gitOutput("log", "--no-merges", "--format=%H%x00%s%x00%b%x1e", revRange)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []changelogEntry
+	var unclassified []int
+	for _, record := range strings.Split(out, "\x1e") {
+		fields := strings.SplitN(strings.TrimLeft(record, "\n"), "\x00", 3)
+		if len(fields) < 2 || fields[0] == "" {
+			continue
+		}
+		entry := changelogEntry{SHA: fields[0], Subject: strings.TrimSpace(fields[1]), Description: strings.TrimSpace(fields[1])}
+		if len(fields) == 3 && strings.Contains(fields[2], "BREAKING CHANGE") {
+			entry.Breaking = true
+		}
+		if m := conventionalPrefixPattern.FindStringSubmatch(entry.Subject); m != nil {
+			entry.Type = normalizeChangeType(m[1])
+			entry.Scope = strings.Trim(m[2], "()")
+			entry.Description = strings.TrimSpace(entry.Subject[len(m[0]):])
+			if strings.Contains(m[0], "!") {
+				entry.Breaking = true
+			}
+		} else {
+			unclassified = append(unclassified, len(entries))
+		}
+		for _, match := range pullRequestRefPattern.FindAllStringSubmatch(entry.Subject, -1) {
+			if n, err := strconv.Atoi(match[1]); err == nil {
+				entry.PullRequest = append(entry.PullRequest, n)
+			}
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("no commits in %s", revRange)
+	}
+
+	if len(unclassified) > 0 {
+		classifyChangelogEntries(ctx, entries, unclassified, opts.offline)
+	}
+
+	log := &changelog{
+		Version: version,
+		Date:    time.Now().Format("2006-01-02"),
+		From:    from,
+		To:      to,
+		RepoURL: changelogRepoURL(),
+	}
+	for _, section := range changelogSections {
+		var sectionEntries []changelogEntry
+		for _, entry := range entries {
+			key := entry.Type
+			if entry.Breaking {
+				key = "breaking"
+			}
+			if key == section.key {
+				sectionEntries = append(sectionEntries, entry)
+			}
+		}
+		if len(sectionEntries) > 0 {
+			log.Sections = append(log.Sections, changelogSection{Type: section.key, Title: section.title, Entries: sectionEntries})
+		}
+	}
+	return log, nil
+}
+
+func normalizeChangeType(kind string) string {
+	switch kind {
+	case "feat", "fix", "perf", "refactor", "docs", "build", "chore":
+		return kind
+	case "test", "tests":
+		return "test"
+	case "ci":
+		return "build"
+	case "style":
+		return "chore"
+	default:
+		return "other"
+	}
+}
+
+// classifyChangelogEntries assigns a type to commits without a conventional
+// prefix, asking the model when possible and guessing from the leading verb
+// otherwise.
+func classifyChangelogEntries(ctx *snap.Context, entries []changelogEntry, indexes []int, offline bool) {
+	if !offline {
+		if apiKey, err := resolveOpenAIKey(ctx.Context()); err == nil {
+			if types, err := classifyChangelogWithModel(ctx, apiKey, entries, indexes); err == nil {
+				for _, i := range indexes {
+					if kind, ok := types[i]; ok {
+						entries[i].Type = kind
+					}
+				}
+			} else {
+				fmt.Fprintf(ctx.Stderr(), "Model classification failed (%v); guessing from commit subjects instead.\n", err)
+			}
+		}
+	}
+
+	for _, i := range indexes {
+		if entries[i].Type == "" {
+			entries[i].Type = guessChangeType(entries[i].Subject)
+		}
+	}
+}
+
+func classifyChangelogWithModel(ctx *snap.Context, apiKey string, entries []changelogEntry, indexes []int) (map[int]string, error) {
+	systemPrompt := "You classify git commit subjects for a changelog. Use exactly one of these types per commit: feat, fix, perf, refactor, docs, test, build, chore, other. Respond with JSON only, in the form {\"types\":{\"1\":\"feat\",\"2\":\"fix\"}}, keyed by the commit number you were given."
+
+	var prompt strings.Builder
+	prompt.WriteString("Classify these commits.\n\n")
+	for n, i := range indexes {
+		fmt.Fprintf(&prompt, "%d. %s\n", n+1, entries[i].Subject)
+	}
+
+	fmt.Fprintf(ctx.Stderr(), "ℹ️ Asking %s to classify %d commits...\n", commitModelName, len(indexes))
+	response, err := requestChatCompletion(ctx.Context(), apiKey, systemPrompt, prompt.String())
+	if err != nil {
+		return nil, err
+	}
+
+	trimmed := strings.TrimSpace(response)
+	if start := strings.Index(trimmed, "{"); start >= 0 {
+		if end := strings.LastIndex(trimmed, "}"); end > start {
+			trimmed = trimmed[start : end+1]
+		}
+	}
+	var decoded struct {
+		Types map[string]string `json:"types"`
+	}
+	if err := json.Unmarshal([]byte(trimmed), &decoded); err != nil {
+		return nil, fmt.Errorf("decode classification: %w", err)
+	}
+
+	types := make(map[int]string)
+	for key, kind := range decoded.Types {
+		n, err := strconv.Atoi(strings.TrimSpace(key))
+		if err != nil || n < 1 || n > len(indexes) {
+			continue
+		}
+		types[indexes[n-1]] = normalizeChangeType(strings.ToLower(strings.TrimSpace(kind)))
+	}
+	return types, nil
+}
+
+// guessChangeType maps the leading verb of subject to a change type, after
+// dropping any "scope:" or "[tag]" prefix.
+func guessChangeType(subject string) string {
+	_, _, subject = splitCommitSubjectPrefix(subject)
+	word := strings.ToLower(strings.Trim(strings.Fields(subject + " x")[0], ":,."))
+	switch word {
+	case "add", "adds", "added", "implement", "introduce", "support", "allow", "enable", "create":
+		return "feat"
+	case "fix", "fixes", "fixed", "correct", "prevent", "handle", "resolve", "avoid", "repair":
+		return "fix"
+	case "speed", "optimize", "optimise", "cache":
+		return "perf"
+	case "refactor", "rename", "move", "extract", "simplify", "restructure", "clean", "cleanup":
+		return "refactor"
+	case "document", "docs", "doc", "readme":
+		return "docs"
+	case "test", "tests":
+		return "test"
+	case "bump", "upgrade", "build", "ci", "release":
+		return "build"
+	case "remove", "delete", "drop", "update", "tweak", "chore":
+		return "chore"
+	}
+	return "other"
+}
+
+func exactTag(rev string) string {
+	out, err := exec.Command("git", "describe", "--tags", "--exact-match", rev).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// changelogRepoURL returns the GitHub URL pull request numbers link to. In a
+// private fork the numbers refer to the upstream project.
+func changelogRepoURL() string {
+	remote := "origin"
+	if isPrivateForkRepo() {
+		remote = "upstream"
+	}
+	exists, url, err := gitRemoteState(remote)
+	if err != nil || !exists {
+		return ""
+	}
+	host, repoPath, ok := extractRemoteHostPath(url)
+	if !ok || host != "github.com" || strings.Count(repoPath, "/") != 1 {
+		return ""
+	}
+	return "https://github.com/" + repoPath
+}
+
+func renderChangelogMarkdown(log *changelog) string {
+	var b strings.Builder
+	if log.Version == "Unreleased" {
+		b.WriteString("## Unreleased\n")
+	} else {
+		fmt.Fprintf(&b, "## %s - %s\n", log.Version, log.Date)
+	}
+
+	for _, section := range log.Sections {
+		fmt.Fprintf(&b, "\n### %s\n\n", section.Title)
+		for _, entry := range section.Entries {
+			description := entry.Description
+			if log.RepoURL != "" {
+				description = pullRequestRefPattern.ReplaceAllString(description, "[#$1]("+log.RepoURL+"/pull/$1)")
+			}
+			b.WriteString("- ")
+			if entry.Scope != "" {
+				fmt.Fprintf(&b, "**%s:** ", entry.Scope)
+			}
+			b.WriteString(description)
+			if len(entry.PullRequest) == 0 {
+				fmt.Fprintf(&b, " (%s)", shortSHA(entry.SHA))
+			}
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+func changelogPath(output string) (string, error) {
+	if output != "" {
+		return output, nil
+	}
+	root, err := gitOutput("rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(strings.TrimSpace(root), changelogFileName), nil
+}
+
+// writeChangelogSection inserts the rendered section above the newest entry
+// of path, replacing an existing Unreleased section.
+func writeChangelogSection(path string, log *changelog) error {
+	section := renderChangelogMarkdown(log)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("read %s: %w", path, err)
+		}
+		data = []byte("# Changelog\n")
+	}
+
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	insertAt, replaceEnd := len(lines), -1
+	for i, line := range lines {
+		if !strings.HasPrefix(line, "## ") {
+			continue
+		}
+		heading := strings.TrimSpace(strings.TrimPrefix(line, "## "))
+		name := strings.Trim(strings.Fields(heading + " x")[0], "[]")
+		if name == log.Version && log.Version != "Unreleased" {
+			return fmt.Errorf("%s already has a section for %s", path, log.Version)
+		}
+		if insertAt == len(lines) {
+			insertAt = i
+		}
+		if name == "Unreleased" && replaceEnd < 0 {
+			insertAt = i
+			replaceEnd = len(lines)
+			for j := i + 1; j < len(lines); j++ {
+				if strings.HasPrefix(lines[j], "## ") {
+					replaceEnd = j
+					break
+				}
+			}
+		}
+	}
+
+	var result []string
+	result = append(result, lines[:insertAt]...)
+	for len(result) > 0 && strings.TrimSpace(result[len(result)-1]) == "" {
+		result = result[:len(result)-1]
+	}
+	result = append(result, "", strings.TrimRight(section, "\n"))
+	rest := lines[insertAt:]
+	if replaceEnd >= 0 {
+		rest = lines[replaceEnd:]
+	}
+	if len(rest) > 0 {
+		result = append(result, "")
+		result = append(result, rest...)
+	}
+
+	if err := os.WriteFile(path, []byte(strings.Join(result, "\n")+"\n"), 0o644); err != nil {
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	return nil
+}
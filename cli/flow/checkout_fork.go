@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/dzonerzy/go-snap/snap"
+)
+
+// githubBranchRef names a branch on a GitHub repository, possibly a fork.
+// For pull request URLs only owner, repo and pullRequest are known until the
+// head is looked up.
+type githubBranchRef struct {
+	owner       string
+	repo        string
+	branch      string
+	pullRequest int
+	// baseOwner and baseRepo are the repository the URL pointed at; they are
+	// empty for a bare owner:branch reference.
+	baseOwner string
+	baseRepo  string
+}
+
+// parseGitHubBranchRef recognises pull request and compare URLs and
+// owner:branch references. It reports false for anything else, including
+// /tree/ URLs, which gitCheckout already handles.
+func parseGitHubBranchRef(input string) (githubBranchRef, bool, error) {
+	if !strings.HasPrefix(input, "http://") && !strings.HasPrefix(input, "https://") {
+		if !strings.Contains(input, ":") {
+			return githubBranchRef{}, false, nil
+		}
+		ref, err := parseCompareHead(input, "", "")
+		return ref, err == nil, err
+	}
+
+	u, err := url.Parse(input)
+	if err != nil {
+		return githubBranchRef{}, false, fmt.Errorf("parse url %q: %w", input, err)
+	}
+	host := strings.ToLower(u.Host)
+	if host != "github.com" && host != "www.github.com" {
+		return githubBranchRef{}, false, nil
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) < 4 {
+		return githubBranchRef{}, false, nil
+	}
+	owner, repo := parts[0], strings.TrimSuffix(parts[1], ".git")
+
+	switch strings.ToLower(parts[2]) {
+	case "pull":
+		number, err := strconv.Atoi(parts[3])
+		if err != nil || number <= 0 {
+			return githubBranchRef{}, false, fmt.Errorf("invalid pull request number %q", parts[3])
+		}
+		return githubBranchRef{owner: owner, repo: repo, pullRequest: number, baseOwner: owner, baseRepo: repo}, true, nil
+	case "compare":
+		spec := strings.Join(parts[3:], "/")
+		head := spec
+		if idx := strings.Index(spec, "..."); idx >= 0 {
+			head = spec[idx+3:]
+		} else if idx := strings.Index(spec, ".."); idx >= 0 {
+			head = spec[idx+2:]
+		}
+		ref, err := parseCompareHead(head, owner, repo)
+		return ref, err == nil, err
+	default:
+		return githubBranchRef{}, false, nil
+	}
+}
+
+// parseCompareHead parses the head of a comparison: branch, owner:branch or
+// owner:repo:branch, defaulting to the base repository.
+func parseCompareHead(spec, baseOwner, baseRepo string) (githubBranchRef, error) {
+	ref := githubBranchRef{owner: baseOwner, repo: baseRepo, baseOwner: baseOwner, baseRepo: baseRepo}
+	fields := strings.SplitN(spec, ":", 3)
+	switch len(fields) {
+	case 1:
+		ref.branch = fields[0]
+	case 2:
+		ref.owner, ref.branch = fields[0], fields[1]
+	default:
+		ref.owner, ref.repo, ref.branch = fields[0], fields[1], fields[2]
+	}
+	if ref.owner == "" || ref.branch == "" || strings.ContainsAny(ref.owner, "/ ") {
+		return githubBranchRef{}, fmt.Errorf("expected owner:branch, got %q", spec)
+	}
+	return ref, nil
+}
+
+// checkoutGitHubBranchRef checks out a branch named by a pull request,
+// compare URL or owner:branch. Branches on forks get a remote named after the
+// owner, reusing any remote that already points at the fork, and a local
+// branch named owner/branch.
+func checkoutGitHubBranchRef(ctx *snap.Context, ref githubBranchRef, remotes []string, opts checkoutOptions) error {
+	if ref.pullRequest > 0 {
+		fmt.Fprintf(ctx.Stdout(), "ℹ️ Looking up pull request #%d on %s/%s\n", ref.pullRequest, ref.owner, ref.repo)
+		head, err := pullRequestHead(ctx.Context(), ref.owner, ref.repo, ref.pullRequest)
+		if err != nil {
+			return err
+		}
+		ref.owner, ref.repo, ref.branch = head.owner, head.repo, head.branch
+	}
+
+	baseRemote, baseURL, err := findBaseRemote(remotes, ref.baseOwner, ref.baseRepo)
+	if err != nil {
+		return err
+	}
+	if ref.baseOwner == "" {
+		_, basePath, _ := extractRemoteHostPath(baseURL)
+		ref.baseOwner, ref.baseRepo, _ = strings.Cut(basePath, "/")
+	}
+	if ref.repo == "" {
+		ref.repo = ref.baseRepo
+	}
+
+	if strings.EqualFold(ref.owner, ref.baseOwner) && strings.EqualFold(ref.repo, ref.baseRepo) {
+		return checkoutRemoteBranch(ctx, baseRemote, ref.branch, ref.branch, opts)
+	}
+
+	forkURL := githubRepoURL(ref.owner, ref.repo, baseURL)
+	remote, err := findRemoteForURL(remotes, forkURL)
+	if err != nil {
+		return err
+	}
+	if remote == "" {
+		remote = ref.owner
+		exists, existingURL, err := gitRemoteState(remote)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return fmt.Errorf("remote %q already points at %s, not %s; rename it or add the fork yourself", remote, existingURL, forkURL)
+		}
+		if err := runGitCommandStreaming(ctx, "remote", "add", remote, forkURL); err != nil {
+			return fmt.Errorf("git remote add %s %s: %w", remote, forkURL, err)
+		}
+		fmt.Fprintf(ctx.Stdout(), "✔️ Added remote %s -> %s\n", remote, forkURL)
+	}
+
+	local := ref.owner + "/" + ref.branch
+	if remote == "origin" {
+		// The head lives on your own fork, which already has short names.
+		local = ref.branch
+	}
+	return checkoutRemoteBranch(ctx, remote, ref.branch, local, opts)
+}
+
+// checkoutRemoteBranch fetches branch from remote and checks out local,
+// creating it as a tracking branch when it does not exist yet.
+func checkoutRemoteBranch(ctx *snap.Context, remote, branch, local string, opts checkoutOptions) error {
+	exists, err := gitRefExists("refs/heads/" + local)
+	if err != nil {
+		return fmt.Errorf("check local branch %s: %w", local, err)
+	}
+
+	if err := runGitCommandStreaming(ctx, "fetch", remote, branch); err != nil {
+		if !exists {
+			return fmt.Errorf("git fetch %s %s: %w", remote, branch, err)
+		}
+		fmt.Fprintf(ctx.Stderr(), "ℹ️ %s is not on %s; using the local branch\n", branch, remote)
+	}
+	if exists {
+		return switchToBranch(ctx, local, "", opts)
+	}
+
+	remoteRef := fmt.Sprintf("%s/%s", remote, branch)
+	remoteExists, err := gitRefExists("refs/remotes/" + remoteRef)
+	if err != nil {
+		return fmt.Errorf("check remote branch %s: %w", remoteRef, err)
+	}
+	if !remoteExists {
+		return fmt.Errorf("remote branch %s not found", remoteRef)
+	}
+
+	return switchToBranch(ctx, local, "refs/remotes/"+remoteRef, opts)
+}
+
+// findBaseRemote returns the remote for owner/repo, or for a bare
+// owner:branch the upstream remote when there is one and origin otherwise.
+func findBaseRemote(remotes []string, owner, repo string) (string, string, error) {
+	if owner == "" {
+		preferred := ""
+		for _, r := range remotes {
+			if r == "upstream" {
+				preferred = r
+			}
+		}
+		name, err := selectGitRemote(remotes, preferred)
+		if err != nil {
+			return "", "", err
+		}
+		_, remoteURL, err := gitRemoteState(name)
+		if err != nil {
+			return "", "", err
+		}
+		if host, _, ok := extractRemoteHostPath(remoteURL); !ok || host != "github.com" {
+			return "", "", fmt.Errorf("remote %s (%s) is not a GitHub repository", name, remoteURL)
+		}
+		return name, remoteURL, nil
+	}
+
+	target := githubRepoURL(owner, repo, "")
+	name, err := findRemoteForURL(remotes, target)
+	if err != nil {
+		return "", "", err
+	}
+	if name == "" {
+		return "", "", fmt.Errorf("no remote points at %s/%s; is this the right repository?", owner, repo)
+	}
+	_, remoteURL, err := gitRemoteState(name)
+	if err != nil {
+		return "", "", err
+	}
+	return name, remoteURL, nil
+}
+
+func findRemoteForURL(remotes []string, target string) (string, error) {
+	for _, name := range remotes {
+		exists, remoteURL, err := gitRemoteState(name)
+		if err != nil {
+			return "", err
+		}
+		if exists && urlsEquivalent(remoteURL, target) {
+			return name, nil
+		}
+	}
+	return "", nil
+}
+
+// githubRepoURL builds a clone URL for owner/repo, using ssh when like does.
+func githubRepoURL(owner, repo, like string) string {
+	if strings.HasPrefix(like, "git@") || strings.HasPrefix(like, "ssh://") {
+		return fmt.Sprintf("git@github.com:%s/%s.git", owner, repo)
+	}
+	return fmt.Sprintf("https://github.com/%s/%s.git", owner, repo)
+}
+
+type pullRequestHeadInfo struct {
+	owner  string
+	repo   string
+	branch string
+}
+
+// pullRequestHead looks up the branch a pull request was opened from, using
+// gh when installed and the REST API otherwise.
+func pullRequestHead(parent context.Context, owner, repo string, number int) (pullRequestHeadInfo, error) {
+	path := fmt.Sprintf("repos/%s/%s/pulls/%d", owner, repo, number)
+
+	body, err := githubAPI(parent, http.MethodGet, path, nil)
+	if err != nil {
+		return pullRequestHeadInfo{}, fmt.Errorf("look up pull request #%d: %w", number, err)
+	}
+
+	var pr struct {
+		Head struct {
+			Ref  string `json:"ref"`
+			Repo *struct {
+				Name  string `json:"name"`
+				Owner struct {
+					Login string `json:"login"`
+				} `json:"owner"`
+			} `json:"repo"`
+		} `json:"head"`
+	}
+	if err := json.Unmarshal(body, &pr); err != nil {
+		return pullRequestHeadInfo{}, fmt.Errorf("decode GitHub response: %w", err)
+	}
+	if pr.Head.Repo == nil {
+		return pullRequestHeadInfo{}, fmt.Errorf("the repository pull request #%d was opened from has been deleted", number)
+	}
+	if pr.Head.Ref == "" || pr.Head.Repo.Owner.Login == "" {
+		return pullRequestHeadInfo{}, fmt.Errorf("GitHub response did not include the head of pull request #%d", number)
+	}
+	return pullRequestHeadInfo{owner: pr.Head.Repo.Owner.Login, repo: pr.Head.Repo.Name, branch: pr.Head.Ref}, nil
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/dzonerzy/go-snap/snap"
+	"github.com/ktr0731/go-fuzzyfinder"
+)
+
+// protectedBranchKey lists extra branch names or glob patterns gitCleanup
+// never deletes, on top of the default branch and the usual long-lived ones.
+const protectedBranchKey = "flow.protectedBranch"
+
+var defaultProtectedBranches = []string{"main", "master", "develop", "trunk"}
+
+type cleanupCandidate struct {
+	branch string
+	tip    string
+	reason string
+}
+
+func runGitCleanup(ctx *snap.Context) error {
+	dryRun := false
+	for i := 0; i < ctx.NArgs(); i++ {
+		arg := strings.TrimSpace(ctx.Arg(i))
+		switch arg {
+		case "":
+		case "--dry-run", "-n":
+			dryRun = true
+		default:
+			fmt.Fprintf(ctx.Stderr(), "Usage: %s gitCleanup [--dry-run]\n", commandName)
+			return fmt.Errorf("unexpected argument %q", arg)
+		}
+	}
+
+	if err := ensureGitRepository(); err != nil {
+		return reportError(ctx, err)
+	}
+	base := pickerBaseRef()
+	if base == "" {
+		return reportError(ctx, fmt.Errorf("could not find the default branch to compare against"))
+	}
+
+	candidates, err := findCleanupCandidates(ctx, base)
+	if err != nil {
+		return reportError(ctx, err)
+	}
+	if len(candidates) == 0 {
+		fmt.Fprintf(ctx.Stdout(), "No branches to clean up against %s.\n", base)
+		return nil
+	}
+
+	if dryRun {
+		for _, c := range candidates {
+			fmt.Fprintf(ctx.Stdout(), "  %-30s %s (%s)\n", c.branch, shortSHA(c.tip), c.reason)
+		}
+		fmt.Fprintln(ctx.Stdout(), "Dry run; nothing was deleted.")
+		return nil
+	}
+	if !stdinIsTerminal() {
+		return reportError(ctx, fmt.Errorf("gitCleanup needs a terminal to pick branches; use --dry-run to list them"))
+	}
+
+	selected, err := fuzzyfinder.FindMulti(
+		candidates,
+		func(i int) string {
+			return fmt.Sprintf("%s  (%s)", candidates[i].branch, candidates[i].reason)
+		},
+		fuzzyfinder.WithPromptString("delete (tab to select)> "),
+		fuzzyfinder.WithPreviewWindow(func(i, width, height int) string {
+			if i < 0 {
+				return ""
+			}
+			c := candidates[i]
+			preview := fmt.Sprintf("%s\n%s\n", c.branch, c.reason)
+			if log, err := gitOutput("log", "-5", "--format=%h %s (%cr)", c.tip, "^"+base); err == nil && strings.TrimSpace(log) != "" {
+				preview += "\nNot on " + base + ":\n" + log
+			} else if log, err := gitOutput("log", "-1", "--format=%h %s%n%an, %cr", c.tip); err == nil {
+				preview += "\n" + log
+			}
+			return preview
+		}),
+	)
+	if err != nil {
+		if errors.Is(err, fuzzyfinder.ErrAbort) {
+			fmt.Fprintln(ctx.Stdout(), "Cleanup cancelled.")
+			return nil
+		}
+		return reportError(ctx, fmt.Errorf("select branches: %w", err))
+	}
+
+	deleted := 0
+	for _, idx := range selected {
+		c := candidates[idx]
+		// Merged was checked against the default branch rather than HEAD or
+		// the upstream, which is all branch -d looks at, so force the delete.
+		if err := runGitCommandStreaming(ctx, "branch", "--quiet", "-D", c.branch); err != nil {
+			fmt.Fprintf(ctx.Stderr(), "⚠️ git branch -D %s: %v\n", c.branch, err)
+			continue
+		}
+		deleted++
+		fmt.Fprintf(ctx.Stdout(), "✔️ Deleted %s (was %s, %s)\n", c.branch, shortSHA(c.tip), c.reason)
+	}
+	if deleted > 0 {
+		fmt.Fprintln(ctx.Stdout(), "ℹ️ Restore a branch with git branch <name> <sha>")
+	}
+	return nil
+}
+
+// findCleanupCandidates returns local branches that are merged into base,
+// squash-merged into it, or whose upstream is gone. The current branch,
+// protected branches and branches checked out in a worktree are skipped.
+func findCleanupCandidates(ctx *snap.Context, base string) ([]cleanupCandidate, error) {
+	out, err := gitOutput("for-each-ref", "--format=%(refname:short) %(objectname)", "refs/heads")
+	if err != nil {
+		return nil, err
+	}
+	worktrees, err := listWorktrees()
+	if err != nil {
+		return nil, err
+	}
+	checkedOut := map[string]string{}
+	for _, wt := range worktrees {
+		if wt.branch != "" {
+			checkedOut[wt.branch] = wt.path
+		}
+	}
+	current, _ := currentGitBranch()
+	protected := protectedBranchPatterns(base)
+	merged, gone := branchCleanupState()
+
+	var candidates []cleanupCandidate
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		branch, tip, ok := strings.Cut(line, " ")
+		if !ok || branch == current || isProtectedBranch(branch, protected) {
+			continue
+		}
+
+		reason := ""
+		if _, ok := merged[branch]; ok {
+			reason = "merged"
+		} else if squashMerged(base, tip) {
+			reason = "squash-merged"
+		} else if _, ok := gone[branch]; ok {
+			reason = "upstream gone"
+		} else {
+			continue
+		}
+
+		if dir, ok := checkedOut[branch]; ok {
+			fmt.Fprintf(ctx.Stderr(), "ℹ️ Skipping %s (%s): it is checked out in %s\n", branch, reason, dir)
+			continue
+		}
+		candidates = append(candidates, cleanupCandidate{branch: branch, tip: tip, reason: reason})
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].branch < candidates[j].branch })
+	return candidates, nil
+}
+
+// squashMerged reports whether the changes on tip since it forked from base
+// already landed on base, either as one squashed commit or commit by commit.
+// Both are checked by patch id through git cherry.
+func squashMerged(base, tip string) bool {
+	mergeBase, err := gitOutput("merge-base", base, tip)
+	if err != nil {
+		return false
+	}
+	mergeBase = strings.TrimSpace(mergeBase)
+
+	if out, err := gitOutput("cherry", base, tip, mergeBase); err == nil && allCherryPicked(out) {
+		return true
+	}
+
+	// A throwaway commit with the branch's whole diff stands in for the
+	// squash; it is never referenced and gets garbage collected.
+	tree, err := gitOutput("rev-parse", tip+"^{tree}")
+	if err != nil {
+		return false
+	}
+	squashed, err := gitOutput("commit-tree", strings.TrimSpace(tree), "-p", mergeBase, "-m", "squash")
+	if err != nil {
+		return false
+	}
+	out, err := gitOutput("cherry", base, strings.TrimSpace(squashed), mergeBase)
+	return err == nil && allCherryPicked(out)
+}
+
+// allCherryPicked reports whether git cherry listed at least one commit and
+// found every one of them upstream.
+func allCherryPicked(out string) bool {
+	lines := strings.Fields(out)
+	if len(lines) == 0 {
+		return false
+	}
+	for i := 0; i < len(lines); i += 2 {
+		if lines[i] != "-" {
+			return false
+		}
+	}
+	return true
+}
+
+func protectedBranchPatterns(base string) []string {
+	patterns := append([]string{strings.TrimPrefix(base, "origin/")}, defaultProtectedBranches...)
+	if out, err := gitOutput("config", "--get-all", protectedBranchKey); err == nil {
+		for _, line := range strings.Split(out, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				patterns = append(patterns, line)
+			}
+		}
+	}
+	return patterns
+}
+
+func isProtectedBranch(branch string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if pattern == branch {
+			return true
+		}
+		if ok, _ := path.Match(pattern, branch); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// commitPromptVersion is part of the cache key; bump it whenever the commit
+	// prompt changes enough that cached messages should no longer be reused.
+	commitPromptVersion = "1"
+	commitCacheTTL      = 7 * 24 * time.Hour
+)
+
+// promptCache stores model output under ~/.flow/cache/<subdir>, one JSON file
+// per input. Keys mix in the model and the prompt version, so changing
+// either one stops old answers from being reused.
+type promptCache struct {
+	subdir        string
+	promptVersion string
+}
+
+var commitCache = promptCache{subdir: "commit", promptVersion: commitPromptVersion}
+
+type commitCacheEntry struct {
+	Created    time.Time `json:"created"`
+	Model      string    `json:"model"`
+	Candidates []string  `json:"candidates"`
+}
+
+func (c promptCache) dir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("determine home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".flow", "cache", c.subdir), nil
+}
+
+func (c promptCache) key(input string) string {
+	sum := sha256.New()
+	sum.Write([]byte(commitModelName))
+	sum.Write([]byte{0})
+	sum.Write([]byte(c.promptVersion))
+	sum.Write([]byte{0})
+	sum.Write([]byte(input))
+	return hex.EncodeToString(sum.Sum(nil))
+}
+
+// load decodes the entry stored under key into entry. It reports false when
+// there is no entry or it cannot be decoded; callers check freshness.
+func (c promptCache) load(key string, entry any) (bool, error) {
+	dir, err := c.dir()
+	if err != nil {
+		return false, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, key+".json"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	if err := json.Unmarshal(data, entry); err != nil {
+		return false, nil
+	}
+	return true, nil
+}
+
+func (c promptCache) save(key string, entry any) error {
+	dir, err := c.dir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("create directory %s: %w", dir, err)
+	}
+
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	target := filepath.Join(dir, key+".json")
+	tmp := target + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("write %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		return fmt.Errorf("rename %s: %w", tmp, err)
+	}
+
+	pruneCacheDir(dir)
+	return nil
+}
+
+// cacheEntryFresh reports whether an entry written at created by model may
+// still be reused.
+func cacheEntryFresh(created time.Time, model string) bool {
+	return time.Since(created) <= commitCacheTTL && model == commitModelName
+}
+
+func commitCacheKey(diff string) string {
+	return commitCache.key(diff)
+}
+
+func loadCommitCache(key string) (*commitCacheEntry, error) {
+	var entry commitCacheEntry
+	ok, err := commitCache.load(key, &entry)
+	if err != nil || !ok {
+		return nil, err
+	}
+	if !cacheEntryFresh(entry.Created, entry.Model) || len(entry.Candidates) == 0 {
+		return nil, nil
+	}
+	return &entry, nil
+}
+
+func appendCommitCache(key string, message string) error {
+	message = strings.TrimSpace(message)
+	if key == "" || message == "" {
+		return nil
+	}
+
+	entry, err := loadCommitCache(key)
+	if err != nil || entry == nil {
+		entry = &commitCacheEntry{Created: time.Now(), Model: commitModelName}
+	}
+	for _, existing := range entry.Candidates {
+		if existing == message {
+			return nil
+		}
+	}
+	entry.Candidates = append(entry.Candidates, message)
+	return commitCache.save(key, entry)
+}
+
+func pruneCacheDir(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if time.Since(info.ModTime()) > commitCacheTTL {
+			_ = os.Remove(filepath.Join(dir, entry.Name()))
+		}
+	}
+}
+
+func (p *commitPayload) rememberCandidate(message string) {
+	if p.cacheKey == "" {
+		return
+	}
+	_ = appendCommitCache(p.cacheKey, message)
+}
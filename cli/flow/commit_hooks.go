@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/dzonerzy/go-snap/snap"
+)
+
+const (
+	commitResumeFile = "FLOW_COMMIT_MSG"
+	// maxHookRetries bounds how often a commit is retried after hooks only
+	// reformatted the staged files.
+	maxHookRetries = 2
+)
+
+var (
+	preCommitFailedLine = regexp.MustCompile(`(?m)^(\S.*?)\.{3,}.*Failed\s*$`)
+	huskyFailedLine     = regexp.MustCompile(`husky - (\S+) (?:hook|script) (?:exited|failed)`)
+)
+
+// commitHookError reports a commit a hook rejected; the message has been
+// saved for commit --resume.
+type commitHookError struct {
+	hook string
+}
+
+func (e *commitHookError) Error() string {
+	return fmt.Sprintf("%s failed; fix the reported issues and run %s commit --resume", e.hook, commandName)
+}
+
+// runCommitHooked runs git commit for payload. When a commit hook rejects the
+// commit after only rewriting files, the rewritten files are re-staged and the
+// commit is retried; otherwise the message is saved for commit --resume.
+func runCommitHooked(ctx *snap.Context, payload *commitPayload) error {
+	hooks := installedCommitHooks()
+
+	for attempt := 0; ; attempt++ {
+		var before map[string]struct{}
+		if len(hooks) > 0 {
+			before = unstagedPaths()
+		}
+
+		var output bytes.Buffer
+		args := []string{"commit"}
+		for _, paragraph := range payload.paragraphs {
+			args = append(args, "-m", paragraph)
+		}
+		cmd := exec.Command("git", args...)
+		cmd.Stdout = io.MultiWriter(ctx.Stdout(), &output)
+		cmd.Stderr = io.MultiWriter(ctx.Stderr(), &output)
+		cmd.Stdin = ctx.Stdin()
+		err := cmd.Run()
+		if err == nil {
+			clearCommitResume()
+			recordFlowCommit()
+			return nil
+		}
+
+		if len(hooks) == 0 {
+			saveCommitResume(ctx, payload.message)
+			return fmt.Errorf("git commit: %w", err)
+		}
+
+		var rewritten []string
+		for path := range unstagedPaths() {
+			if _, ok := before[path]; !ok {
+				rewritten = append(rewritten, path)
+			}
+		}
+
+		failed := describeFailedHook(hooks, output.String(), len(rewritten) > 0)
+		if len(rewritten) > 0 && attempt < maxHookRetries {
+			fmt.Fprintf(ctx.Stderr(), "ℹ️ %s rewrote %s; re-staging and retrying the commit\n", failed, strings.Join(rewritten, ", "))
+			addArgs := append([]string{"add", "--"}, rewritten...)
+			if out, addErr := exec.Command("git", addArgs...).CombinedOutput(); addErr != nil {
+				saveCommitResume(ctx, payload.message)
+				return fmt.Errorf("git add: %s", strings.TrimSpace(string(out)))
+			}
+			continue
+		}
+
+		saveCommitResume(ctx, payload.message)
+		return &commitHookError{hook: failed}
+	}
+}
+
+// installedCommitHooks lists the executable hooks git runs during a commit.
+func installedCommitHooks() []string {
+	dir, err := gitHooksDir("")
+	if err != nil {
+		return nil
+	}
+
+	var hooks []string
+	for _, name := range []string{"pre-commit", "prepare-commit-msg", "commit-msg"} {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil || info.IsDir() || info.Mode()&0o111 == 0 {
+			continue
+		}
+		hooks = append(hooks, name)
+	}
+	return hooks
+}
+
+// gitHooksDir returns the directory git runs hooks from in the repository at
+// dir, honouring core.hooksPath. A relative core.hooksPath is taken from the
+// top of the working tree, as git does.
+func gitHooksDir(dir string) (string, error) {
+	out, err := gitInDir(dir, "rev-parse", "--git-path", "hooks").Output()
+	if err != nil {
+		return "", fmt.Errorf("git rev-parse --git-path hooks: %w", err)
+	}
+	hooksDir := strings.TrimSpace(string(out))
+	if out, err := gitInDir(dir, "config", "--path", "--get", "core.hooksPath").Output(); err == nil && strings.TrimSpace(string(out)) != "" {
+		hooksDir = strings.TrimSpace(string(out))
+		if !filepath.IsAbs(hooksDir) {
+			if root, err := gitInDir(dir, "rev-parse", "--show-toplevel").Output(); err == nil {
+				return filepath.Join(strings.TrimSpace(string(root)), hooksDir), nil
+			}
+		}
+	}
+	if !filepath.IsAbs(hooksDir) && dir != "" {
+		hooksDir = filepath.Join(dir, hooksDir)
+	}
+	return hooksDir, nil
+}
+
+func describeFailedHook(hooks []string, output string, rewroteFiles bool) string {
+	var checks []string
+	for _, match := range preCommitFailedLine.FindAllStringSubmatch(output, -1) {
+		checks = append(checks, strings.TrimSpace(match[1]))
+	}
+	if match := huskyFailedLine.FindStringSubmatch(output); match != nil {
+		return match[1] + " hook"
+	}
+
+	hook := ""
+	switch {
+	case len(hooks) == 1:
+		hook = hooks[0]
+	case rewroteFiles || len(checks) > 0:
+		hook = "pre-commit"
+	default:
+		hook = strings.Join(hooks, " or ")
+	}
+
+	if len(checks) > 0 {
+		return fmt.Sprintf("%s hook (%s)", hook, strings.Join(checks, ", "))
+	}
+	return hook + " hook"
+}
+
+func unstagedPaths() map[string]struct{} {
+	paths := make(map[string]struct{})
+	out, err := exec.Command("git", "diff", "--name-only", "-z").Output()
+	if err != nil {
+		return paths
+	}
+	for _, path := range strings.Split(string(out), "\x00") {
+		if path != "" {
+			paths[path] = struct{}{}
+		}
+	}
+	return paths
+}
+
+func commitResumePath() (string, error) {
+	out, err := exec.Command("git", "rev-parse", "--git-path", commitResumeFile).Output()
+	if err != nil {
+		return "", fmt.Errorf("git rev-parse --git-path: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func saveCommitResume(ctx *snap.Context, message string) {
+	path, err := commitResumePath()
+	if err != nil {
+		return
+	}
+	if err := os.WriteFile(path, []byte(strings.TrimSpace(message)+"\n"), 0o644); err != nil {
+		fmt.Fprintf(ctx.Stderr(), "⚠️ Could not save the commit message: %v\n", err)
+		return
+	}
+	fmt.Fprintf(ctx.Stderr(), "ℹ️ Commit message saved to %s\n", path)
+}
+
+func loadCommitResume() (string, error) {
+	path, err := commitResumePath()
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("no saved commit message to resume")
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+func clearCommitResume() {
+	if path, err := commitResumePath(); err == nil {
+		_ = os.Remove(path)
+	}
+}
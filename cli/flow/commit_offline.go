@@ -0,0 +1,345 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os/exec"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxOfflineSubjectRunes = 72
+	emptyTreeHash          = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+)
+
+type offlineFileChange struct {
+	status  string
+	path    string
+	oldPath string
+	added   int
+	removed int
+	binary  bool
+	addSyms []string
+	delSyms []string
+}
+
+// commitDiffSource describes which diff a commit message is generated for:
+// the staged changes, or an existing commit compared with its parent.
+type commitDiffSource struct {
+	diffArgs []string
+	oldRev   string
+	newRev   string
+}
+
+var stagedDiffSource = commitDiffSource{diffArgs: []string{"--cached"}, oldRev: "HEAD"}
+
+func commitDiffSourceFor(sha string) commitDiffSource {
+	parent := emptyTreeHash
+	if out, err := exec.Command("git", "rev-parse", "--verify", "--quiet", sha+"^1").Output(); err == nil {
+		parent = strings.TrimSpace(string(out))
+	}
+	return commitDiffSource{diffArgs: []string{parent, sha}, oldRev: parent, newRev: sha}
+}
+
+func generateOfflineCommitMessage(source commitDiffSource) (string, error) {
+	changes, err := collectOfflineFileChanges(source)
+	if err != nil {
+		return "", err
+	}
+	if len(changes) == 0 {
+		return "", fmt.Errorf("no changes to describe")
+	}
+
+	for _, change := range changes {
+		if !strings.HasSuffix(change.path, ".go") && !strings.HasSuffix(change.oldPath, ".go") {
+			continue
+		}
+		oldPath := change.path
+		if change.oldPath != "" {
+			oldPath = change.oldPath
+		}
+		var before, after map[string]struct{}
+		if change.status != "A" {
+			before = goDeclaredSymbols(gitShowBlob(source.oldRev + ":" + oldPath))
+		}
+		if change.status != "D" {
+			after = goDeclaredSymbols(gitShowBlob(source.newRev + ":" + change.path))
+		}
+		change.addSyms = symbolDifference(after, before)
+		change.delSyms = symbolDifference(before, after)
+	}
+
+	subject := offlineCommitSubject(changes)
+
+	var body strings.Builder
+	totalAdded, totalRemoved := 0, 0
+	for _, change := range changes {
+		totalAdded += change.added
+		totalRemoved += change.removed
+		body.WriteString("- ")
+		body.WriteString(describeOfflineFileChange(change))
+		body.WriteString("\n")
+	}
+	fileWord := "files"
+	if len(changes) == 1 {
+		fileWord = "file"
+	}
+	fmt.Fprintf(&body, "\n%d %s changed, +%d -%d", len(changes), fileWord, totalAdded, totalRemoved)
+
+	return subject + "\n\n" + body.String(), nil
+}
+
+func collectOfflineFileChanges(source commitDiffSource) ([]*offlineFileChange, error) {
+	nameStatusArgs := append([]string{"diff", "--name-status", "-M"}, source.diffArgs...)
+	nameStatus, err := exec.Command("git", nameStatusArgs...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %w", strings.Join(nameStatusArgs, " "), err)
+	}
+
+	var changes []*offlineFileChange
+	byPath := make(map[string]*offlineFileChange)
+	scanner := bufio.NewScanner(strings.NewReader(string(nameStatus)))
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) < 2 || fields[0] == "" {
+			continue
+		}
+		change := &offlineFileChange{status: fields[0][:1], path: fields[len(fields)-1]}
+		if (change.status == "R" || change.status == "C") && len(fields) >= 3 {
+			change.oldPath = fields[1]
+		}
+		changes = append(changes, change)
+		byPath[change.path] = change
+	}
+
+	numstatArgs := append([]string{"diff", "--numstat", "-M"}, source.diffArgs...)
+	numstat, err := exec.Command("git", numstatArgs...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %w", strings.Join(numstatArgs, " "), err)
+	}
+
+	scanner = bufio.NewScanner(strings.NewReader(string(numstat)))
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) < 3 {
+			continue
+		}
+		target := fields[len(fields)-1]
+		if strings.Contains(target, " => ") {
+			target = resolveNumstatRename(target)
+		}
+		change, ok := byPath[target]
+		if !ok {
+			continue
+		}
+		if fields[0] == "-" && fields[1] == "-" {
+			change.binary = true
+			continue
+		}
+		change.added, _ = strconv.Atoi(fields[0])
+		change.removed, _ = strconv.Atoi(fields[1])
+	}
+
+	return changes, nil
+}
+
+func resolveNumstatRename(raw string) string {
+	open := strings.Index(raw, "{")
+	closing := strings.Index(raw, "}")
+	if open >= 0 && closing > open {
+		inner := raw[open+1 : closing]
+		_, newPart, _ := strings.Cut(inner, " => ")
+		return path.Clean(raw[:open] + newPart + raw[closing+1:])
+	}
+	_, newPath, _ := strings.Cut(raw, " => ")
+	return newPath
+}
+
+func gitShowBlob(spec string) []byte {
+	out, err := exec.Command("git", "show", spec).Output()
+	if err != nil {
+		return nil
+	}
+	return out
+}
+
+func goDeclaredSymbols(src []byte) map[string]struct{} {
+	if len(src) == 0 {
+		return nil
+	}
+
+	file, err := parser.ParseFile(token.NewFileSet(), "", src, parser.SkipObjectResolution)
+	if err != nil || file == nil {
+		return nil
+	}
+
+	symbols := make(map[string]struct{})
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			name := d.Name.Name
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				if recv := receiverTypeName(d.Recv.List[0].Type); recv != "" {
+					name = recv + "." + name
+				}
+			}
+			symbols[name] = struct{}{}
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch sp := spec.(type) {
+				case *ast.TypeSpec:
+					symbols[sp.Name.Name] = struct{}{}
+				case *ast.ValueSpec:
+					for _, ident := range sp.Names {
+						if ident.Name != "_" {
+							symbols[ident.Name] = struct{}{}
+						}
+					}
+				}
+			}
+		}
+	}
+
+	return symbols
+}
+
+func receiverTypeName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return receiverTypeName(t.X)
+	case *ast.Ident:
+		return t.Name
+	case *ast.IndexExpr:
+		return receiverTypeName(t.X)
+	case *ast.IndexListExpr:
+		return receiverTypeName(t.X)
+	}
+	return ""
+}
+
+func symbolDifference(a, b map[string]struct{}) []string {
+	var diff []string
+	for name := range a {
+		if _, ok := b[name]; !ok {
+			diff = append(diff, name)
+		}
+	}
+	sort.Strings(diff)
+	return diff
+}
+
+func offlineCommitSubject(changes []*offlineFileChange) string {
+	var added, removed []string
+	allNew, allDeleted := true, true
+	for _, change := range changes {
+		added = append(added, change.addSyms...)
+		removed = append(removed, change.delSyms...)
+		if change.status != "A" {
+			allNew = false
+		}
+		if change.status != "D" {
+			allDeleted = false
+		}
+	}
+
+	var candidates []string
+	switch {
+	case len(added) > 0 && len(removed) > 0:
+		candidates = append(candidates, fmt.Sprintf("Add %s and remove %s", summarizeNames(added, 2), summarizeNames(removed, 1)))
+		candidates = append(candidates, fmt.Sprintf("Add %s", summarizeNames(added, 2)))
+	case len(added) > 0:
+		candidates = append(candidates, fmt.Sprintf("Add %s", summarizeNames(added, 3)))
+		candidates = append(candidates, fmt.Sprintf("Add %s", summarizeNames(added, 1)))
+	case len(removed) > 0:
+		candidates = append(candidates, fmt.Sprintf("Remove %s", summarizeNames(removed, 3)))
+		candidates = append(candidates, fmt.Sprintf("Remove %s", summarizeNames(removed, 1)))
+	}
+
+	verb := "Update"
+	switch {
+	case allNew:
+		verb = "Add"
+	case allDeleted:
+		verb = "Remove"
+	}
+
+	if len(changes) == 1 {
+		change := changes[0]
+		if change.status == "R" {
+			candidates = append(candidates, fmt.Sprintf("Rename %s to %s", change.oldPath, change.path))
+		}
+		candidates = append(candidates, fmt.Sprintf("%s %s", verb, change.path))
+		candidates = append(candidates, fmt.Sprintf("%s %s", verb, path.Base(change.path)))
+	} else {
+		dir := commonChangeDir(changes)
+		if dir != "" {
+			candidates = append(candidates, fmt.Sprintf("%s %d files in %s", verb, len(changes), dir))
+		}
+		candidates = append(candidates, fmt.Sprintf("%s %d files", verb, len(changes)))
+	}
+
+	for _, candidate := range candidates {
+		if len([]rune(candidate)) <= maxOfflineSubjectRunes {
+			return candidate
+		}
+	}
+	return string([]rune(candidates[len(candidates)-1])[:maxOfflineSubjectRunes])
+}
+
+func summarizeNames(names []string, limit int) string {
+	if len(names) <= limit {
+		if len(names) == 1 {
+			return names[0]
+		}
+		return strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(names[:limit], ", "), len(names)-limit)
+}
+
+func commonChangeDir(changes []*offlineFileChange) string {
+	common := path.Dir(changes[0].path)
+	for _, change := range changes[1:] {
+		dir := path.Dir(change.path)
+		for common != "." && dir != common && !strings.HasPrefix(dir, common+"/") {
+			common = path.Dir(common)
+		}
+	}
+	if common == "." {
+		return ""
+	}
+	return common
+}
+
+func describeOfflineFileChange(change *offlineFileChange) string {
+	var parts []string
+	switch change.status {
+	case "A":
+		parts = append(parts, "new file")
+	case "D":
+		parts = append(parts, "deleted")
+	case "R":
+		parts = append(parts, "renamed from "+change.oldPath)
+	case "C":
+		parts = append(parts, "copied from "+change.oldPath)
+	}
+
+	if change.binary {
+		parts = append(parts, "binary")
+	} else {
+		parts = append(parts, fmt.Sprintf("+%d -%d", change.added, change.removed))
+	}
+	if len(change.addSyms) > 0 {
+		parts = append(parts, "add "+summarizeNames(change.addSyms, 5))
+	}
+	if len(change.delSyms) > 0 {
+		parts = append(parts, "remove "+summarizeNames(change.delSyms, 5))
+	}
+
+	return change.path + ": " + strings.Join(parts, "; ")
+}
@@ -0,0 +1,584 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/dzonerzy/go-snap/snap"
+)
+
+const maxSplitHunkRunes = 1500
+
+type stagedDiffFile struct {
+	path   string
+	header string
+	hunks  []string
+	atomic bool
+}
+
+type splitHunk struct {
+	id    string
+	file  int
+	index int
+	label string
+}
+
+type splitGroup struct {
+	message string
+	hunks   []string
+}
+
+type splitSource struct {
+	files []*stagedDiffFile
+	hunks []splitHunk
+	byID  map[string]splitHunk
+}
+
+func runCommitSplit(ctx *snap.Context) error {
+	if ctx.NArgs() != 0 {
+		return reportError(ctx, fmt.Errorf("Usage: %s commitSplit", commandName))
+	}
+
+	if err := ensureGitRepository(); err != nil {
+		return reportError(ctx, err)
+	}
+
+	if _, err := exec.Command("git", "rev-parse", "--verify", "--quiet", "HEAD").Output(); err != nil {
+		return reportError(ctx, fmt.Errorf("commitSplit needs an existing HEAD commit; use %s commit for the initial commit", commandName))
+	}
+
+	if err := runGitCommandStreaming(ctx, "add", "."); err != nil {
+		return reportError(ctx, fmt.Errorf("git add .: %w", err))
+	}
+
+	diffOutput, err := exec.Command("git", "diff", "--cached", "--no-color", "--no-ext-diff", "--no-renames", "--binary", "--src-prefix=a/", "--dst-prefix=b/").Output()
+	if err != nil {
+		return reportError(ctx, fmt.Errorf("git diff --cached: %w", err))
+	}
+
+	source := newSplitSource(parseStagedDiff(string(diffOutput)))
+	if len(source.hunks) == 0 {
+		return reportError(ctx, fmt.Errorf("no staged changes to commit; stage files with git add"))
+	}
+
+	plan := proposeSplitPlan(ctx, source)
+
+	plan, confirmed, err := promptSplitPlan(ctx, source, plan)
+	if err != nil {
+		return reportError(ctx, err)
+	}
+	if !confirmed {
+		fmt.Fprintln(ctx.Stdout(), "Split cancelled.")
+		return nil
+	}
+
+	if err := applySplitPlan(ctx, source, plan); err != nil {
+		return reportError(ctx, err)
+	}
+
+	fmt.Fprintf(ctx.Stdout(), "✔️ Created %d commits\n", len(plan))
+	return nil
+}
+
+func parseStagedDiff(diff string) []*stagedDiffFile {
+	var (
+		files    []*stagedDiffFile
+		current  *stagedDiffFile
+		header   strings.Builder
+		hunk     strings.Builder
+		inHeader bool
+	)
+
+	flushHunk := func() {
+		if current != nil && hunk.Len() > 0 {
+			current.hunks = append(current.hunks, hunk.String())
+		}
+		hunk.Reset()
+	}
+	flushFile := func() {
+		flushHunk()
+		if current != nil {
+			if inHeader {
+				current.header = header.String()
+			}
+			if len(current.hunks) == 0 {
+				current.atomic = true
+			}
+		}
+		header.Reset()
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(diff))
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text() + "\n"
+
+		if strings.HasPrefix(line, "diff --git ") {
+			flushFile()
+			current = &stagedDiffFile{path: pathFromDiffGitLine(line)}
+			files = append(files, current)
+			inHeader = true
+			header.WriteString(line)
+			continue
+		}
+		if current == nil {
+			continue
+		}
+
+		if strings.HasPrefix(line, "@@") {
+			if inHeader {
+				current.header = header.String()
+				inHeader = false
+			}
+			flushHunk()
+			hunk.WriteString(line)
+			continue
+		}
+
+		if inHeader {
+			header.WriteString(line)
+			switch {
+			case strings.HasPrefix(line, "new file mode"),
+				strings.HasPrefix(line, "deleted file mode"),
+				strings.HasPrefix(line, "GIT binary patch"),
+				strings.HasPrefix(line, "Binary files"):
+				current.atomic = true
+			case strings.HasPrefix(line, "+++ b/"):
+				current.path = strings.TrimSpace(strings.TrimPrefix(line, "+++ b/"))
+			case strings.HasPrefix(line, "--- a/") && current.path == "":
+				current.path = strings.TrimSpace(strings.TrimPrefix(line, "--- a/"))
+			}
+			continue
+		}
+
+		hunk.WriteString(line)
+	}
+	flushFile()
+
+	return files
+}
+
+func pathFromDiffGitLine(line string) string {
+	trimmed := strings.TrimSpace(strings.TrimPrefix(line, "diff --git "))
+	if idx := strings.LastIndex(trimmed, " b/"); idx >= 0 {
+		return trimmed[idx+3:]
+	}
+	return trimmed
+}
+
+func newSplitSource(files []*stagedDiffFile) *splitSource {
+	source := &splitSource{files: files, byID: make(map[string]splitHunk)}
+	add := func(h splitHunk) {
+		h.id = fmt.Sprintf("H%d", len(source.hunks)+1)
+		source.hunks = append(source.hunks, h)
+		source.byID[h.id] = h
+	}
+
+	for i, file := range files {
+		if file.atomic {
+			add(splitHunk{file: i, index: -1, label: file.path + " (whole file)"})
+			continue
+		}
+		for j, body := range file.hunks {
+			headerLine := body
+			if idx := strings.IndexByte(headerLine, '\n'); idx >= 0 {
+				headerLine = headerLine[:idx]
+			}
+			add(splitHunk{file: i, index: j, label: file.path + " " + headerLine})
+		}
+	}
+
+	return source
+}
+
+func (s *splitSource) hunkText(h splitHunk) string {
+	file := s.files[h.file]
+	if h.index < 0 {
+		return file.header + strings.Join(file.hunks, "")
+	}
+	return file.hunks[h.index]
+}
+
+func (s *splitSource) patchFor(ids []string) string {
+	selected := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		selected[id] = struct{}{}
+	}
+
+	var b strings.Builder
+	for fileIdx, file := range s.files {
+		var bodies []string
+		whole := false
+		for _, h := range s.hunks {
+			if h.file != fileIdx {
+				continue
+			}
+			if _, ok := selected[h.id]; !ok {
+				continue
+			}
+			if h.index < 0 {
+				whole = true
+				break
+			}
+			bodies = append(bodies, file.hunks[h.index])
+		}
+
+		switch {
+		case whole:
+			b.WriteString(file.header)
+			b.WriteString(strings.Join(file.hunks, ""))
+		case len(bodies) > 0:
+			b.WriteString(file.header)
+			b.WriteString(strings.Join(bodies, ""))
+		}
+	}
+
+	return b.String()
+}
+
+func proposeSplitPlan(ctx *snap.Context, source *splitSource) []splitGroup {
+	apiKey, err := resolveOpenAIKey(ctx.Context())
+	if err != nil {
+		fmt.Fprintf(ctx.Stdout(), "ℹ️ %v; grouping hunks by directory instead.\n", err)
+		return groupHunksByDirectory(source)
+	}
+
+	fmt.Fprintf(ctx.Stdout(), "ℹ️ Asking %s to group %d hunks...\n", commitModelName, len(source.hunks))
+	plan, err := generateSplitPlan(ctx, apiKey, source)
+	if err != nil {
+		fmt.Fprintf(ctx.Stderr(), "Model grouping failed (%v); grouping hunks by directory instead.\n", err)
+		return groupHunksByDirectory(source)
+	}
+
+	return plan
+}
+
+func generateSplitPlan(ctx *snap.Context, apiKey string, source *splitSource) ([]splitGroup, error) {
+	systemPrompt := "You are an expert software engineer who splits large changes into small, logical git commits. Group related hunks together so each commit is coherent and builds on the previous ones. Write each commit message in imperative mood with a subject line under 72 characters and an optional bullet body. Never include secrets, credentials, or values from .env files, environment variables, or keys—even if they appear in the diff. Respond with JSON only, in the form {\"commits\":[{\"message\":\"...\",\"hunks\":[\"H1\",\"H2\"]}]}. Every hunk ID must appear in exactly one commit, and commits must be listed in the order they should be applied."
+
+	var userPrompt strings.Builder
+	userPrompt.WriteString("Split these staged hunks into logical commits.\n")
+	budget := maxCommitDiffRunes
+	for _, h := range source.hunks {
+		text := source.hunkText(h)
+		limit := maxSplitHunkRunes
+		if budget < limit {
+			limit = budget
+		}
+		runes := []rune(text)
+		if len(runes) > limit {
+			text = string(runes[:limit]) + "\n[hunk truncated]\n"
+			runes = runes[:limit]
+		}
+		budget -= len(runes)
+
+		fmt.Fprintf(&userPrompt, "\n### %s %s\n", h.id, h.label)
+		if limit > 0 {
+			userPrompt.WriteString(text)
+		}
+	}
+
+	response, err := requestChatCompletion(ctx.Context(), apiKey, systemPrompt, userPrompt.String())
+	if err != nil {
+		return nil, err
+	}
+
+	return parseSplitPlanJSON(response, source)
+}
+
+func parseSplitPlanJSON(response string, source *splitSource) ([]splitGroup, error) {
+	trimmed := strings.TrimSpace(response)
+	if start := strings.Index(trimmed, "{"); start >= 0 {
+		if end := strings.LastIndex(trimmed, "}"); end > start {
+			trimmed = trimmed[start : end+1]
+		}
+	}
+
+	var decoded struct {
+		Commits []struct {
+			Message string   `json:"message"`
+			Hunks   []string `json:"hunks"`
+		} `json:"commits"`
+	}
+	if err := json.Unmarshal([]byte(trimmed), &decoded); err != nil {
+		return nil, fmt.Errorf("decode split plan: %w", err)
+	}
+
+	plan := make([]splitGroup, 0, len(decoded.Commits))
+	for _, commit := range decoded.Commits {
+		plan = append(plan, splitGroup{
+			message: strings.TrimSpace(trimMatchingQuotes(strings.TrimSpace(commit.Message))),
+			hunks:   commit.Hunks,
+		})
+	}
+
+	if err := validateSplitPlan(plan, source); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+func validateSplitPlan(plan []splitGroup, source *splitSource) error {
+	if len(plan) == 0 {
+		return fmt.Errorf("plan has no commits")
+	}
+
+	seen := make(map[string]int)
+	for i, group := range plan {
+		if strings.TrimSpace(group.message) == "" {
+			return fmt.Errorf("commit %d has an empty message", i+1)
+		}
+		if len(group.hunks) == 0 {
+			return fmt.Errorf("commit %d has no hunks", i+1)
+		}
+		for _, id := range group.hunks {
+			if _, ok := source.byID[id]; !ok {
+				return fmt.Errorf("commit %d references unknown hunk %s", i+1, id)
+			}
+			if prev, ok := seen[id]; ok {
+				return fmt.Errorf("hunk %s is assigned to commits %d and %d", id, prev, i+1)
+			}
+			seen[id] = i + 1
+		}
+	}
+
+	for _, h := range source.hunks {
+		if _, ok := seen[h.id]; !ok {
+			return fmt.Errorf("hunk %s (%s) is not assigned to any commit", h.id, h.label)
+		}
+	}
+
+	return nil
+}
+
+func groupHunksByDirectory(source *splitSource) []splitGroup {
+	byDir := make(map[string][]string)
+	filesByDir := make(map[string][]string)
+	for _, h := range source.hunks {
+		filePath := source.files[h.file].path
+		dir := path.Dir(filePath)
+		byDir[dir] = append(byDir[dir], h.id)
+		files := filesByDir[dir]
+		if len(files) == 0 || files[len(files)-1] != filePath {
+			filesByDir[dir] = append(files, filePath)
+		}
+	}
+
+	dirs := make([]string, 0, len(byDir))
+	for dir := range byDir {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	plan := make([]splitGroup, 0, len(dirs))
+	for _, dir := range dirs {
+		files := filesByDir[dir]
+		var message strings.Builder
+		switch {
+		case len(files) == 1:
+			fmt.Fprintf(&message, "Update %s", files[0])
+		case dir == ".":
+			fmt.Fprintf(&message, "Update %d files in repository root", len(files))
+		default:
+			fmt.Fprintf(&message, "Update %d files in %s", len(files), dir)
+		}
+		if len(files) > 1 {
+			message.WriteString("\n")
+			for _, file := range files {
+				fmt.Fprintf(&message, "\n- %s", file)
+			}
+		}
+		plan = append(plan, splitGroup{message: message.String(), hunks: byDir[dir]})
+	}
+
+	return plan
+}
+
+func printSplitPlan(ctx *snap.Context, source *splitSource, plan []splitGroup) {
+	for i, group := range plan {
+		fmt.Fprintln(ctx.Stdout(), strings.Repeat("─", 60))
+		fmt.Fprintf(ctx.Stdout(), "Commit %d/%d\n", i+1, len(plan))
+		fmt.Fprintln(ctx.Stdout(), group.message)
+		fmt.Fprintln(ctx.Stdout())
+		for _, id := range group.hunks {
+			fmt.Fprintf(ctx.Stdout(), "  %s %s\n", id, source.byID[id].label)
+		}
+	}
+	fmt.Fprintln(ctx.Stdout(), strings.Repeat("─", 60))
+}
+
+func promptSplitPlan(ctx *snap.Context, source *splitSource, plan []splitGroup) ([]splitGroup, bool, error) {
+	current := plan
+
+	for {
+		printSplitPlan(ctx, source, current)
+		fmt.Fprintln(ctx.Stdout(), "Options: [y] commit all  [n] cancel  [e] edit plan")
+		fmt.Fprint(ctx.Stdout(), "Choice [y/n/e]: ")
+
+		choice, err := readConfirmationChoice(ctx)
+		if err != nil {
+			return nil, false, fmt.Errorf("reading choice: %w", err)
+		}
+
+		switch strings.ToLower(string(choice)) {
+		case "y":
+			return current, true, nil
+		case "n":
+			return current, false, nil
+		case "e":
+			edited, err := editCommitMessage(ctx, formatSplitPlan(source, current))
+			if err != nil {
+				return nil, false, fmt.Errorf("edit split plan: %w", err)
+			}
+			updated, err := parseSplitPlanText(edited)
+			if err == nil {
+				err = validateSplitPlan(updated, source)
+			}
+			if err != nil {
+				fmt.Fprintf(ctx.Stdout(), "Edited plan is invalid (%v); keeping previous plan.\n", err)
+				continue
+			}
+			current = updated
+		default:
+			fmt.Fprintln(ctx.Stdout(), "Please choose y, n, or e.")
+		}
+	}
+}
+
+func formatSplitPlan(source *splitSource, plan []splitGroup) string {
+	var b strings.Builder
+	b.WriteString("# Each commit starts with an \"=== commit\" line followed by its message.\n")
+	b.WriteString("# The \"=== hunks\" line lists the hunk IDs for that commit, one per line.\n")
+	b.WriteString("# Move hunk lines between commits, reorder commits, or edit messages.\n")
+	b.WriteString("# Every hunk must be assigned exactly once. Lines starting with '#' outside a message are ignored.\n")
+	for _, group := range plan {
+		b.WriteString("\n=== commit\n")
+		b.WriteString(group.message)
+		b.WriteString("\n=== hunks\n")
+		for _, id := range group.hunks {
+			fmt.Fprintf(&b, "%s %s\n", id, source.byID[id].label)
+		}
+	}
+	return b.String()
+}
+
+func parseSplitPlanText(text string) ([]splitGroup, error) {
+	var (
+		plan    []splitGroup
+		message []string
+		hunks   []string
+		mode    string
+	)
+
+	flush := func() {
+		if mode == "" {
+			return
+		}
+		trimmed := strings.TrimSpace(strings.Join(message, "\n"))
+		if trimmed != "" || len(hunks) > 0 {
+			plan = append(plan, splitGroup{message: trimmed, hunks: hunks})
+		}
+		message = nil
+		hunks = nil
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		// Messages keep their '#' lines, which may be issue references.
+		if strings.HasPrefix(line, "#") && mode != "message" {
+			continue
+		}
+		switch strings.TrimSpace(line) {
+		case "=== commit":
+			flush()
+			mode = "message"
+			continue
+		case "=== hunks":
+			if mode == "" {
+				return nil, fmt.Errorf("\"=== hunks\" appears before any \"=== commit\"")
+			}
+			mode = "hunks"
+			continue
+		}
+
+		switch mode {
+		case "message":
+			message = append(message, strings.TrimRight(line, " \t"))
+		case "hunks":
+			if fields := strings.Fields(line); len(fields) > 0 {
+				hunks = append(hunks, fields[0])
+			}
+		default:
+			if strings.TrimSpace(line) != "" {
+				return nil, fmt.Errorf("unexpected line before first commit: %q", line)
+			}
+		}
+	}
+	flush()
+
+	return plan, nil
+}
+
+func applySplitPlan(ctx *snap.Context, source *splitSource, plan []splitGroup) error {
+	headOut, err := exec.Command("git", "rev-parse", "HEAD").Output()
+	if err != nil {
+		return fmt.Errorf("git rev-parse HEAD: %w", err)
+	}
+	originalHead := strings.TrimSpace(string(headOut))
+
+	treeOut, err := exec.Command("git", "write-tree").Output()
+	if err != nil {
+		return fmt.Errorf("git write-tree: %w", err)
+	}
+	originalTree := strings.TrimSpace(string(treeOut))
+
+	rollback := func(cause error) error {
+		fmt.Fprintln(ctx.Stderr(), "Rolling back to the original index...")
+		if out, err := exec.Command("git", "reset", "-q", "--soft", originalHead).CombinedOutput(); err != nil {
+			return fmt.Errorf("%v; rollback git reset --soft %s failed: %s", cause, originalHead, strings.TrimSpace(string(out)))
+		}
+		if out, err := exec.Command("git", "read-tree", originalTree).CombinedOutput(); err != nil {
+			return fmt.Errorf("%v; rollback git read-tree %s failed: %s", cause, originalTree, strings.TrimSpace(string(out)))
+		}
+		return cause
+	}
+
+	if out, err := exec.Command("git", "reset", "-q").CombinedOutput(); err != nil {
+		return rollback(fmt.Errorf("git reset: %s", strings.TrimSpace(string(out))))
+	}
+
+	for i, group := range plan {
+		patch := source.patchFor(group.hunks)
+		cmd := exec.Command("git", "apply", "--cached", "--binary", "-")
+		cmd.Stdin = strings.NewReader(patch)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return rollback(fmt.Errorf("git apply --cached for commit %d: %s", i+1, strings.TrimSpace(string(out))))
+		}
+
+		paragraphs := splitCommitMessageParagraphs(group.message)
+		payload := &commitPayload{message: group.message, paragraphs: paragraphs}
+		fmt.Fprintf(ctx.Stdout(), "Committing %d/%d: %s\n", i+1, len(plan), paragraphs[0])
+		if err := commitWithPayload(ctx, payload); err != nil {
+			// The saved message belongs to this group only, but the rollback
+			// stages everything again, so point at commitSplit rather than at
+			// a plain resume.
+			var hookErr *commitHookError
+			if errors.As(err, &hookErr) {
+				err = fmt.Errorf("%s rejected commit %d/%d; fix the reported issues and run %s commitSplit again (its message stays saved for %s commit --resume)", hookErr.hook, i+1, len(plan), commandName, commandName)
+			}
+			return rollback(err)
+		}
+	}
+
+	finalOut, err := exec.Command("git", "write-tree").Output()
+	if err == nil && strings.TrimSpace(string(finalOut)) != originalTree {
+		fmt.Fprintln(ctx.Stderr(), "Warning: the committed tree differs from the originally staged tree; review with git diff HEAD.")
+	}
+
+	return nil
+}
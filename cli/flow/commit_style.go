@@ -0,0 +1,316 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	commitStyleSampleSize  = 50
+	commitStyleMinSamples  = 5
+	commitStyleFewShotSize = 8
+)
+
+var (
+	conventionalPrefixPattern = regexp.MustCompile(`^(feat|fix|chore|docs|refactor|test|tests|perf|build|ci|style|revert)(\([^)]*\))?!?:\s+`)
+	bracketPrefixPattern      = regexp.MustCompile(`^\[([^\]]+)\]\s+`)
+	scopePrefixPattern        = regexp.MustCompile(`^([A-Za-z0-9_./-]+):\s+`)
+	ticketIDPattern           = regexp.MustCompile(`\b[A-Z][A-Z0-9]+-\d+\b|#\d+\b`)
+)
+
+type commitStyle struct {
+	samples        []string
+	prefixKind     string
+	prefixes       []string
+	lowercase      bool
+	uppercase      bool
+	emoji          bool
+	tickets        bool
+	trailingPeriod bool
+	medianLength   int
+	bodyRatio      float64
+}
+
+func learnCommitStyle() *commitStyle {
+	out, err := exec.Command("git", "log", "-n", fmt.Sprint(commitStyleSampleSize), "--no-merges", "--format=%s%x1f%b%x1e").Output()
+	if err != nil {
+		return nil
+	}
+
+	var (
+		subjects []string
+		withBody int
+	)
+	for _, record := range strings.Split(string(out), "\x1e") {
+		record = strings.TrimLeft(record, "\n")
+		if strings.TrimSpace(record) == "" {
+			continue
+		}
+		subject, body, _ := strings.Cut(record, "\x1f")
+		subject = strings.TrimSpace(subject)
+		if subject == "" || strings.HasPrefix(subject, "Revert \"") || strings.HasPrefix(subject, "fixup! ") {
+			continue
+		}
+		subjects = append(subjects, subject)
+		if strings.TrimSpace(stripCommitTrailers(body)) != "" {
+			withBody++
+		}
+	}
+
+	if len(subjects) < commitStyleMinSamples {
+		return nil
+	}
+
+	return analyzeCommitSubjects(subjects, withBody)
+}
+
+func analyzeCommitSubjects(subjects []string, withBody int) *commitStyle {
+	style := &commitStyle{}
+	if len(subjects) > commitStyleFewShotSize {
+		style.samples = subjects[:commitStyleFewShotSize]
+	} else {
+		style.samples = subjects
+	}
+
+	var (
+		kinds                      = make(map[string]int)
+		prefixCounts               = make(map[string]int)
+		lower, upper, emoji        int
+		tickets, periods, lettered int
+		lengths                    []int
+	)
+
+	for _, subject := range subjects {
+		kind, prefix, description := splitCommitSubjectPrefix(subject)
+		kinds[kind]++
+		if prefix != "" {
+			prefixCounts[prefix]++
+		}
+
+		if first, _ := utf8.DecodeRuneInString(description); unicode.IsLetter(first) {
+			lettered++
+			if unicode.IsLower(first) {
+				lower++
+			} else if unicode.IsUpper(first) {
+				upper++
+			}
+		}
+		if containsEmoji(subject) {
+			emoji++
+		}
+		if ticketIDPattern.MatchString(subject) {
+			tickets++
+		}
+		if strings.HasSuffix(subject, ".") {
+			periods++
+		}
+		lengths = append(lengths, utf8.RuneCountInString(subject))
+	}
+
+	total := len(subjects)
+	majority := func(n, of int) bool { return of > 0 && n*10 >= of*7 }
+	frequent := func(n int) bool { return n*10 >= total*3 }
+
+	for kind, count := range kinds {
+		if kind != "" && count*2 >= total {
+			style.prefixKind = kind
+		}
+	}
+	style.prefixes = topCommitPrefixes(prefixCounts, 5)
+	style.lowercase = majority(lower, lettered)
+	style.uppercase = majority(upper, lettered)
+	style.emoji = frequent(emoji)
+	style.tickets = frequent(tickets)
+	style.trailingPeriod = periods*2 > total
+
+	sort.Ints(lengths)
+	style.medianLength = lengths[len(lengths)/2]
+	style.bodyRatio = float64(withBody) / float64(total)
+
+	return style
+}
+
+func splitCommitSubjectPrefix(subject string) (string, string, string) {
+	if m := conventionalPrefixPattern.FindStringSubmatch(subject); m != nil {
+		return "conventional", strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(m[0]), ":")), subject[len(m[0]):]
+	}
+	if m := bracketPrefixPattern.FindStringSubmatch(subject); m != nil {
+		return "bracket", m[1], subject[len(m[0]):]
+	}
+	if m := scopePrefixPattern.FindStringSubmatch(subject); m != nil {
+		return "scope", m[1], subject[len(m[0]):]
+	}
+	return "", "", subject
+}
+
+func topCommitPrefixes(counts map[string]int, limit int) []string {
+	prefixes := make([]string, 0, len(counts))
+	for prefix, count := range counts {
+		if count > 1 {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	sort.Slice(prefixes, func(i, j int) bool {
+		if counts[prefixes[i]] != counts[prefixes[j]] {
+			return counts[prefixes[i]] > counts[prefixes[j]]
+		}
+		return prefixes[i] < prefixes[j]
+	})
+	if len(prefixes) > limit {
+		prefixes = prefixes[:limit]
+	}
+	return prefixes
+}
+
+func containsEmoji(s string) bool {
+	for _, r := range s {
+		if (r >= 0x1F300 && r <= 0x1FAFF) || (r >= 0x2600 && r <= 0x27BF) {
+			return true
+		}
+	}
+	return false
+}
+
+func stripCommitTrailers(body string) string {
+	lines := strings.Split(strings.TrimSpace(body), "\n")
+	end := len(lines)
+	for end > 0 {
+		line := strings.TrimSpace(lines[end-1])
+		if line == "" {
+			end--
+			continue
+		}
+		if key, _, ok := strings.Cut(line, ": "); ok && !strings.Contains(key, " ") {
+			end--
+			continue
+		}
+		break
+	}
+	return strings.Join(lines[:end], "\n")
+}
+
+func (s *commitStyle) promptSection() string {
+	if s == nil {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("Match this repository's commit message style:\n")
+	switch s.prefixKind {
+	case "conventional":
+		b.WriteString("- Start the subject with a conventional commit type such as feat:, fix: or chore: (with an optional scope).\n")
+	case "bracket":
+		b.WriteString("- Start the subject with a bracketed component prefix like [pkg].\n")
+	case "scope":
+		b.WriteString("- Start the subject with a component prefix followed by a colon, like cli:.\n")
+	}
+	if len(s.prefixes) > 0 && s.prefixKind != "" {
+		fmt.Fprintf(&b, "- Common prefixes: %s.\n", strings.Join(s.prefixes, ", "))
+	}
+	switch {
+	case s.lowercase:
+		b.WriteString("- Start the description in lowercase.\n")
+	case s.uppercase:
+		b.WriteString("- Start the description with a capital letter.\n")
+	}
+	if s.trailingPeriod {
+		b.WriteString("- End the subject with a period.\n")
+	} else {
+		b.WriteString("- Do not end the subject with a period.\n")
+	}
+	if s.emoji {
+		b.WriteString("- Subjects often include an emoji.\n")
+	}
+	if s.tickets {
+		b.WriteString("- Subjects often reference a ticket ID; keep any ID that is evident from the changes.\n")
+	}
+	fmt.Fprintf(&b, "- Typical subject length is about %d characters.\n", s.medianLength)
+	switch {
+	case s.bodyRatio < 0.2:
+		b.WriteString("- Usually write only a subject line, without a body.\n")
+	case s.bodyRatio > 0.6:
+		b.WriteString("- Usually include a short body explaining the change.\n")
+	}
+	b.WriteString("\nRecent commit subjects from this repository:\n")
+	for _, sample := range s.samples {
+		fmt.Fprintf(&b, "- %s\n", sample)
+	}
+
+	return strings.TrimRight(b.String(), "\n")
+}
+
+func (s *commitStyle) format(message string) string {
+	if s == nil {
+		return message
+	}
+
+	subject, rest, hasRest := strings.Cut(message, "\n")
+	subject = strings.TrimSpace(subject)
+
+	kind, prefix, description := splitCommitSubjectPrefix(subject)
+	switch {
+	case s.prefixKind == "bracket" && kind == "scope":
+		subject = "[" + prefix + "] " + description
+	case s.prefixKind == "scope" && kind == "bracket":
+		subject = prefix + ": " + description
+	case s.prefixKind == "conventional" && kind == "":
+		// Only the type can be told from the subject; a [pkg] or scope:
+		// prefix would need to know what the change touches, so those are
+		// left to the model.
+		subject = conventionalTypeFor(description) + ": " + description
+	}
+
+	kind, _, description = splitCommitSubjectPrefix(subject)
+	head := strings.TrimSuffix(subject, description)
+	if !startsWithAcronym(description) {
+		first, size := utf8.DecodeRuneInString(description)
+		switch {
+		case s.lowercase && unicode.IsUpper(first):
+			description = string(unicode.ToLower(first)) + description[size:]
+		case s.uppercase && unicode.IsLower(first) && kind != "conventional":
+			description = string(unicode.ToUpper(first)) + description[size:]
+		}
+	}
+	subject = head + description
+
+	if s.trailingPeriod {
+		if last, _ := utf8.DecodeLastRuneInString(subject); unicode.IsLetter(last) || unicode.IsDigit(last) {
+			subject += "."
+		}
+	} else {
+		subject = strings.TrimSuffix(subject, ".")
+	}
+
+	if !hasRest {
+		return subject
+	}
+	return subject + "\n" + rest
+}
+
+// conventionalTypeFor guesses the conventional commit type of a subject
+// from its leading verb, falling back to chore.
+func conventionalTypeFor(description string) string {
+	if kind := guessChangeType(description); kind != "other" {
+		return kind
+	}
+	return "chore"
+}
+
+func startsWithAcronym(s string) bool {
+	word := s
+	if idx := strings.IndexFunc(word, unicode.IsSpace); idx >= 0 {
+		word = word[:idx]
+	}
+	upper := 0
+	for _, r := range word {
+		if unicode.IsUpper(r) {
+			upper++
+		}
+	}
+	return upper > 1 || strings.ContainsAny(word, "._/()")
+}
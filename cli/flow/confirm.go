@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/dzonerzy/go-snap/snap"
+)
+
+// textReview configures reviewGeneratedText for one kind of generated text.
+type textReview struct {
+	// noun names the text in prompts, e.g. "commit message".
+	noun string
+	// acceptLabel and editLabel describe [y] and [e] in the options line.
+	acceptLabel string
+	editLabel   string
+	// regenerate rewrites current following an optional instruction; nil
+	// hides [r] and [s]. An interrupted generation returns the partial text
+	// with errGenerationInterrupted.
+	regenerate func(current, instruction string) (string, error)
+	// shortenLabel and shortenInstruction describe [s]; empty hides it.
+	shortenLabel       string
+	shortenInstruction string
+	// showDiff prints what the text describes for [d]; nil hides it.
+	showDiff func()
+}
+
+// reviewGeneratedText shows candidates[current] and loops until the user
+// accepts or cancels. Edits and regenerations become new candidates that [h]
+// can switch between.
+func reviewGeneratedText(ctx *snap.Context, review textReview, candidates []string, current int) (string, bool, error) {
+	addCandidate := func(text string) {
+		candidates = append(candidates, text)
+		current = len(candidates) - 1
+	}
+
+	keys := []string{"y", "n", "e"}
+	options := fmt.Sprintf("Options: [y] %s  [n] cancel  [e] %s", review.acceptLabel, review.editLabel)
+	if review.regenerate != nil {
+		keys = append(keys, "r")
+		options += "  [r] regenerate"
+		if review.shortenInstruction != "" {
+			keys = append(keys, "s")
+			options += "  [s] " + review.shortenLabel
+		}
+	}
+	if review.showDiff != nil {
+		keys = append(keys, "d")
+		options += "  [d] show diff stat"
+	}
+	keys = append(keys, "h")
+	options += "  [h] history"
+
+	regenerate := func(instruction string) {
+		text, err := review.regenerate(candidates[current], instruction)
+		if errors.Is(err, errGenerationInterrupted) && text != "" {
+			fmt.Fprintf(ctx.Stdout(), "Generation interrupted; the partial %s was added as a candidate.\n", review.noun)
+			addCandidate(text)
+			return
+		}
+		if err != nil {
+			fmt.Fprintln(ctx.Stderr(), err.Error())
+			return
+		}
+		addCandidate(text)
+	}
+
+	for {
+		fmt.Fprintln(ctx.Stdout(), strings.Repeat("─", 60))
+		if len(candidates) > 1 {
+			fmt.Fprintf(ctx.Stdout(), "Review %s (candidate %d/%d):\n", review.noun, current+1, len(candidates))
+		} else {
+			fmt.Fprintf(ctx.Stdout(), "Review %s:\n", review.noun)
+		}
+		fmt.Fprintln(ctx.Stdout(), strings.Repeat("─", 60))
+		fmt.Fprintln(ctx.Stdout(), candidates[current])
+		fmt.Fprintln(ctx.Stdout(), strings.Repeat("─", 60))
+		fmt.Fprintln(ctx.Stdout(), options)
+		fmt.Fprintf(ctx.Stdout(), "Choice [%s]: ", strings.Join(keys, "/"))
+
+		choice, err := readConfirmationChoice(ctx)
+		if err != nil {
+			return "", false, fmt.Errorf("reading choice: %w", err)
+		}
+
+		switch key := strings.ToLower(string(choice)); {
+		case key == "y":
+			return candidates[current], true, nil
+		case key == "n":
+			return candidates[current], false, nil
+		case key == "e":
+			edited, err := editCommitMessage(ctx, candidates[current])
+			if err != nil {
+				return "", false, fmt.Errorf("edit %s: %w", review.noun, err)
+			}
+			trimmed := strings.TrimSpace(edited)
+			if trimmed == "" {
+				fmt.Fprintf(ctx.Stdout(), "Edited %s is empty; keeping the previous one.\n", review.noun)
+				continue
+			}
+			if trimmed != candidates[current] {
+				addCandidate(trimmed)
+			}
+		case key == "r" && review.regenerate != nil:
+			feedback, err := promptLine(ctx, "Instruction for the model (optional, Enter to skip): ")
+			if err != nil {
+				return "", false, fmt.Errorf("read instruction: %w", err)
+			}
+			regenerate(feedback)
+		case key == "s" && review.regenerate != nil && review.shortenInstruction != "":
+			regenerate(review.shortenInstruction)
+		case key == "d" && review.showDiff != nil:
+			review.showDiff()
+		case key == "h":
+			selected, err := selectCommitCandidate(ctx, candidates, current)
+			if err != nil {
+				return "", false, err
+			}
+			current = selected
+		default:
+			fmt.Fprintf(ctx.Stdout(), "Please choose %s, or %s.\n", strings.Join(keys[:len(keys)-1], ", "), keys[len(keys)-1])
+		}
+	}
+}
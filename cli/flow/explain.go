@@ -0,0 +1,291 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/dzonerzy/go-snap/snap"
+)
+
+const (
+	// maxExplainCommits caps how many commits of a range or file history are
+	// collected; maxExplainHeaderRunes caps each commit's header and stat.
+	maxExplainCommits     = 200
+	maxExplainFileCommits = 20
+	maxExplainHeaderRunes = 1500
+	// explainHeaderShare is the fraction of the budget headers may use before
+	// older commits shrink to one line.
+	explainHeaderShare  = 2
+	explainSystemPrompt = "You are a senior engineer helping a reviewer get up to speed on changes in a git repository. Explain in plain language what changed and why it matters: start with a two or three sentence overview, then the notable changes grouped by theme, then anything a reviewer should double-check (risky edits, behaviour changes, migrations, removed APIs). Refer to files and commits by name. Be concise, use Markdown headings and bullets, and never repeat secrets, credentials, or values from .env files even if they appear in the diff."
+)
+
+type explainSection struct {
+	header string
+	patch  string
+	// oneline is "<short sha> <subject>", used when the header does not fit.
+	oneline string
+}
+
+func runExplain(ctx *snap.Context) error {
+	usage := fmt.Sprintf("Usage: %s explain [<rev|range|path> | --upstream]", commandName)
+
+	var (
+		target   string
+		upstream bool
+	)
+	for i := 0; i < ctx.NArgs(); i++ {
+		arg := strings.TrimSpace(ctx.Arg(i))
+		if arg == "" {
+			continue
+		}
+		switch {
+		case arg == "--upstream":
+			upstream = true
+		case strings.HasPrefix(arg, "--"):
+			fmt.Fprintln(ctx.Stderr(), usage)
+			return fmt.Errorf("unknown flag %q", arg)
+		case target == "":
+			target = arg
+		default:
+			fmt.Fprintln(ctx.Stderr(), usage)
+			return fmt.Errorf("unexpected argument %q", arg)
+		}
+	}
+	if upstream && target != "" {
+		fmt.Fprintln(ctx.Stderr(), usage)
+		return fmt.Errorf("--upstream does not take a revision")
+	}
+
+	if err := ensureGitRepository(); err != nil {
+		return reportError(ctx, err)
+	}
+
+	if upstream {
+		syncRange, err := lastSyncRange()
+		if err != nil {
+			return reportError(ctx, err)
+		}
+		target = syncRange
+	}
+	if target == "" {
+		target = "HEAD"
+	}
+
+	subject, sections, err := collectExplainSections(target)
+	if err != nil {
+		return reportError(ctx, err)
+	}
+
+	apiKey, err := resolveOpenAIKey(ctx.Context())
+	if err != nil {
+		return reportError(ctx, err)
+	}
+
+	packed, truncated := packExplainSections(sections, maxCommitDiffRunes)
+	var prompt strings.Builder
+	fmt.Fprintf(&prompt, "Explain %s (%d commits).\n\n", subject, len(sections))
+	prompt.WriteString(packed)
+	if truncated {
+		prompt.WriteString("\n\n[Some patches were truncated to fit; rely on the commit messages and stats for the rest.]")
+	}
+
+	fmt.Fprintf(ctx.Stderr(), "ℹ️ Explaining %s with %s...\n\n", subject, commitModelName)
+	_, err = streamChatCompletion(ctx.Context(), apiKey, explainSystemPrompt, prompt.String(), streamSpinner, func(delta string) {
+		fmt.Fprint(ctx.Stdout(), delta)
+	})
+	fmt.Fprintln(ctx.Stdout())
+	if errors.Is(err, errGenerationInterrupted) {
+		fmt.Fprintln(ctx.Stderr(), "ℹ️ Explanation interrupted.")
+		return nil
+	}
+	if err != nil {
+		return reportError(ctx, fmt.Errorf("explain %s: %w", subject, err))
+	}
+	return nil
+}
+
+// collectExplainSections returns a description of target and one section per
+// commit: a single revision, a range, or the recent history of a path.
+func collectExplainSections(target string) (string, []explainSection, error) {
+	var (
+		shas     []string
+		pathspec []string
+		subject  string
+	)
+
+	switch {
+	case strings.Contains(target, ".."):
+		out, err := gitOutput("rev-list", "--no-merges", "--reverse", target)
+		if err != nil {
+			return "", nil, err
+		}
+		shas = strings.Fields(out)
+		if len(shas) > maxExplainCommits {
+			shas = shas[len(shas)-maxExplainCommits:]
+		}
+		subject = "the range " + target
+	case isCommitish(target):
+		sha, err := resolveCommitSHA(target)
+		if err != nil {
+			return "", nil, err
+		}
+		shas = []string{sha}
+		subject = "commit " + shortSHA(sha)
+	default:
+		if _, err := os.Stat(target); err != nil {
+			if out, lsErr := gitOutput("ls-files", "--", target); lsErr != nil || strings.TrimSpace(out) == "" {
+				return "", nil, fmt.Errorf("%q is not a revision, range, or path in this repository", target)
+			}
+		}
+		out, err := gitOutput("log", "--no-merges", "--format=%H", "-n", fmt.Sprint(maxExplainFileCommits), "--", target)
+		if err != nil {
+			return "", nil, err
+		}
+		shas = strings.Fields(out)
+		for i, j := 0, len(shas)-1; i < j; i, j = i+1, j-1 {
+			shas[i], shas[j] = shas[j], shas[i]
+		}
+		pathspec = []string{"--", target}
+		subject = "the recent history of " + target
+	}
+	if len(shas) == 0 {
+		return "", nil, fmt.Errorf("no commits found for %s", target)
+	}
+
+	sections := make([]explainSection, 0, len(shas))
+	for _, sha := range shas {
+		headerArgs := append([]string{"show", "--stat", "--format=commit %H%nAuthor: %an <%ae>%nDate: %ad%n%n%B", "--diff-merges=first-parent", sha}, pathspec...)
+		header, err := gitOutput(headerArgs...)
+		if err != nil {
+			return "", nil, err
+		}
+		patchArgs := append([]string{"show", "--format=", "--diff-merges=first-parent", sha}, pathspec...)
+		patch, err := gitOutput(patchArgs...)
+		if err != nil {
+			return "", nil, err
+		}
+		oneline, err := gitOutput("show", "-s", "--format=%h %s", sha)
+		if err != nil {
+			return "", nil, err
+		}
+		sections = append(sections, explainSection{header: strings.TrimSpace(header), patch: strings.TrimSpace(patch), oneline: strings.TrimSpace(oneline)})
+	}
+	return subject, sections, nil
+}
+
+func isCommitish(target string) bool {
+	return exec.Command("git", "rev-parse", "--verify", "--quiet", target+"^{commit}").Run() == nil
+}
+
+// packExplainSections fits the commit headers and as much of each patch as
+// the budget allows, favouring the newest commits. Walking back from the
+// newest, commits keep their full header while headers fit in
+// 1/explainHeaderShare of the budget; older ones shrink to one line without
+// their patch, and the oldest drop out once even that no longer fits. What is
+// left goes to the patches, newest first.
+func packExplainSections(sections []explainSection, budget int) (string, bool) {
+	headers := make([]string, len(sections))
+	for i, section := range sections {
+		header := []rune(section.header)
+		if len(header) > maxExplainHeaderRunes {
+			header = append(header[:maxExplainHeaderRunes], []rune("\n[commit details truncated]")...)
+		}
+		headers[i] = string(header)
+	}
+
+	// Sections are oldest first: those from full on keep their header and
+	// patch, those from brief up to full are shown as one line, and the ones
+	// before brief are dropped. The newest commit is always kept in full.
+	headerBudget := budget / explainHeaderShare
+	used, full := 0, len(sections)
+	for full > 0 {
+		size := len([]rune(headers[full-1]))
+		if used+size > headerBudget && full < len(sections) {
+			break
+		}
+		used += size
+		full--
+	}
+	brief := full
+	for brief > 0 {
+		size := len([]rune(sections[brief-1].oneline)) + len("commit \n")
+		if used+size > headerBudget {
+			break
+		}
+		used += size
+		brief--
+	}
+
+	shares := make([]int, len(sections))
+	remaining := budget - used
+	for i := len(sections) - 1; i >= full; i-- {
+		shares[i] = min(len([]rune(sections[i].patch)), max(remaining, 0))
+		remaining -= shares[i]
+	}
+
+	var (
+		b         strings.Builder
+		truncated = full > 0
+	)
+	if brief > 0 {
+		fmt.Fprintf(&b, "[%d older commits omitted]\n\n", brief)
+	}
+	for i := brief; i < full; i++ {
+		b.WriteString("commit " + sections[i].oneline + "\n")
+	}
+	if full > brief {
+		b.WriteString("[details and patches of the commits above omitted]\n\n")
+	}
+
+	for i := full; i < len(sections); i++ {
+		b.WriteString(headers[i])
+		b.WriteString("\n\n")
+
+		patch := []rune(sections[i].patch)
+		switch {
+		case len(patch) == 0:
+		case shares[i] == 0:
+			truncated = true
+			b.WriteString("[patch omitted]\n\n")
+		case shares[i] < len(patch):
+			truncated = true
+			b.WriteString(string(patch[:shares[i]]))
+			b.WriteString("\n[patch truncated]\n\n")
+		default:
+			b.WriteString(string(patch))
+			b.WriteString("\n\n")
+		}
+	}
+	return strings.TrimSpace(b.String()), truncated
+}
+
+// lastSyncRange returns the upstream commits the last gitSyncFork of the
+// current branch brought in.
+func lastSyncRange() (string, error) {
+	branch, err := currentGitBranch()
+	if err != nil {
+		return "", err
+	}
+	from := gitConfigValue("branch." + branch + ".flowSyncFrom")
+	to := gitConfigValue("branch." + branch + ".flowSyncTo")
+	if from == "" || to == "" {
+		return "", fmt.Errorf("no gitSyncFork recorded for %s; run %s gitSyncFork first", branch, commandName)
+	}
+	if from == to {
+		return "", fmt.Errorf("the last gitSyncFork of %s brought in no upstream changes", branch)
+	}
+	return from + ".." + to, nil
+}
+
+// recordSyncRange remembers which upstream commits a sync of branch brought
+// in, for explain --upstream.
+func recordSyncRange(branch, from, to string) {
+	if from == "" || to == "" {
+		return
+	}
+	_ = exec.Command("git", "config", "branch."+branch+".flowSyncFrom", from).Run()
+	_ = exec.Command("git", "config", "branch."+branch+".flowSyncTo", to).Run()
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const githubAPIVersion = "2022-11-28"
+
+// githubAPI calls the GitHub REST API at path (e.g. "repos/o/r/pulls") and
+// returns the response body. It goes through the gh CLI when it is installed
+// so its login is reused, and otherwise talks HTTP with GITHUB_TOKEN or
+// GH_TOKEN. A non-nil body is sent as JSON. Non-2xx responses become errors
+// carrying GitHub's message.
+func githubAPI(parent context.Context, method, path string, body any) ([]byte, error) {
+	var payload []byte
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		payload = encoded
+	}
+
+	if _, err := exec.LookPath("gh"); err == nil {
+		args := []string{"api", "--method", method, "-H", "X-GitHub-Api-Version: " + githubAPIVersion, path}
+		if payload != nil {
+			args = append(args, "--input", "-")
+		}
+		cmd := exec.CommandContext(parent, "gh", args...)
+		if payload != nil {
+			cmd.Stdin = bytes.NewReader(payload)
+		}
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			if message := githubErrorMessage(out); message != "" {
+				return nil, fmt.Errorf("gh api %s: %s", path, message)
+			}
+			if message := strings.TrimSpace(stderr.String()); message != "" {
+				return nil, fmt.Errorf("gh api %s: %s", path, message)
+			}
+			return nil, fmt.Errorf("gh api %s: %w", path, err)
+		}
+		return out, nil
+	}
+
+	token, ok := lookupNonEmptyEnv("GITHUB_TOKEN")
+	if !ok {
+		token, ok = lookupNonEmptyEnv("GH_TOKEN")
+	}
+	if !ok && method != http.MethodGet {
+		return nil, fmt.Errorf("gh CLI not found and neither GITHUB_TOKEN nor GH_TOKEN is set")
+	}
+
+	requestCtx, cancel := context.WithTimeout(parent, 30*time.Second)
+	defer cancel()
+
+	var reqBody io.Reader
+	if payload != nil {
+		reqBody = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(requestCtx, method, "https://api.github.com/"+path, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", githubAPIVersion)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read GitHub response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		if message := githubErrorMessage(respBody); message != "" {
+			return nil, fmt.Errorf("%s (%s)", message, resp.Status)
+		}
+		return nil, fmt.Errorf("%s", resp.Status)
+	}
+	return respBody, nil
+}
+
+// githubErrorMessage extracts the message field GitHub puts in error
+// responses, or "" when body has none.
+func githubErrorMessage(body []byte) string {
+	var apiErr struct {
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(body, &apiErr) != nil {
+		return ""
+	}
+	return apiErr.Message
+}
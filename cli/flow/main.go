@@ -22,7 +22,6 @@ import (
 	fzfutil "github.com/junegunn/fzf/src/util"
 	"github.com/ktr0731/go-fuzzyfinder"
 	openai "github.com/openai/openai-go"
-	"github.com/openai/openai-go/option"
 	"github.com/openai/openai-go/shared"
 )
 
@@ -270,6 +269,50 @@ func main() {
 		return runCommitReviewAndPush(ctx)
 	})
 
+	registerCommand(app, "commitSplit", "Split the staged changes into several logical commits", func(ctx *snap.Context) error {
+		return runCommitSplit(ctx)
+	})
+
+	registerCommand(app, "reword", "Regenerate the message of an existing commit and rewrite it", func(ctx *snap.Context) error {
+		return runReword(ctx)
+	})
+
+	registerCommand(app, "uncommit", "Undo the last commit fgo created and restage its changes", func(ctx *snap.Context) error {
+		return runUncommit(ctx)
+	})
+
+	registerCommand(app, "snapshot", "Save, list, diff or restore working tree snapshots", func(ctx *snap.Context) error {
+		return runSnapshot(ctx)
+	})
+
+	registerCommand(app, "prCreate", "Generate a pull request title and body for the current branch and open it", func(ctx *snap.Context) error {
+		return runPRCreate(ctx)
+	})
+
+	registerCommand(app, "usage", "Report AI token usage and estimated cost by day, repo and model", func(ctx *snap.Context) error {
+		return runUsage(ctx)
+	})
+
+	registerCommand(app, "explain", "Explain a commit, range or file history in plain language", func(ctx *snap.Context) error {
+		return runExplain(ctx)
+	})
+
+	registerCommand(app, "changelog", "Write release notes for a commit range into CHANGELOG.md", func(ctx *snap.Context) error {
+		return runChangelog(ctx)
+	})
+
+	registerCommand(app, "release", "Bump the semver tag, update the changelog and push the tag", func(ctx *snap.Context) error {
+		return runRelease(ctx)
+	})
+
+	registerCommand(app, "protect", "Block pushes to protected remotes with a pre-push hook", func(ctx *snap.Context) error {
+		return runProtect(ctx)
+	})
+
+	registerCommand(app, "pair", "Add Co-authored-by trailers for a pairing session", func(ctx *snap.Context) error {
+		return runPair(ctx)
+	})
+
 	registerCommand(app, "branchFromClipboard", "Create a git branch from the clipboard name", func(ctx *snap.Context) error {
 		return runBranchFromClipboard(ctx)
 	})
@@ -282,6 +325,14 @@ func main() {
 		return runCloneAndOpen(ctx)
 	})
 
+	registerCommand(app, "worktree", "List, open, remove or prune branch worktrees", func(ctx *snap.Context) error {
+		return runWorktree(ctx)
+	})
+
+	registerCommand(app, "stack", "Track stacked branches, restack them onto their parents and push them", func(ctx *snap.Context) error {
+		return runStack(ctx)
+	})
+
 	registerCommand(app, "gitCheckout", "Check out a branch from the remote, creating a local tracking branch if needed", func(ctx *snap.Context) error {
 		return runGitCheckout(ctx)
 	})
@@ -298,6 +349,10 @@ func main() {
 		return runGitFetchUpstream(ctx)
 	})
 
+	registerCommand(app, "gitCleanup", "Delete local branches that are merged, squash-merged or whose upstream is gone", func(ctx *snap.Context) error {
+		return runGitCleanup(ctx)
+	})
+
 	registerCommand(app, "gitSyncFork", "Update a local branch from upstream using rebase or merge", func(ctx *snap.Context) error {
 		return runGitSyncFork(ctx)
 	})
@@ -339,13 +394,36 @@ func main() {
 		return
 	}
 
+	os.Args = forwardCommandFlags(os.Args)
 	app.RunAndExit()
 }
 
+// forwardCommandFlags inserts "--" after a known command so snap passes its
+// flags through as positional arguments; commands parse their own flags.
+func forwardCommandFlags(argv []string) []string {
+	if len(argv) < 3 || argv[2] == "--" {
+		return argv
+	}
+
+	for _, entry := range commandCatalog {
+		if entry.name == argv[1] {
+			forwarded := make([]string, 0, len(argv)+1)
+			forwarded = append(forwarded, argv[:2]...)
+			forwarded = append(forwarded, "--")
+			return append(forwarded, argv[2:]...)
+		}
+	}
+
+	return argv
+}
+
 func registerCommand(app *snap.App, name, description string, action snap.ActionFunc) {
 	commandCatalog = append(commandCatalog, commandInfo{name: name, description: description})
 	app.Command(name, description).
-		Action(action)
+		Action(func(ctx *snap.Context) error {
+			activeCommandName = name
+			return action(ctx)
+		})
 }
 
 func selectCommandArgs() ([]string, int, error) {
@@ -468,19 +546,157 @@ func printCommandHelp(name string, out io.Writer) bool {
 		fmt.Fprintln(out, "Generate a commit message with GPT-5 nano and create the commit")
 		fmt.Fprintln(out)
 		fmt.Fprintln(out, "Usage:")
-		fmt.Fprintf(out, "  %s commit\n", commandName)
+		fmt.Fprintf(out, "  %s commit [--offline] [--no-cache] [--resume]\n", commandName)
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "Without OPENAI_API_KEY, on model errors, or with --offline, the message is built locally from the diff.")
+		fmt.Fprintln(out, "Messages are cached per staged diff in ~/.flow/cache/commit for 7 days; --no-cache skips the cache.")
+		fmt.Fprintln(out, "If a commit hook rejects the commit, the message is kept; --resume reuses it after you fix the issues.")
 		return true
 	case "commitPush":
 		fmt.Fprintln(out, "Generate a commit message, commit, and push to the default remote")
 		fmt.Fprintln(out)
 		fmt.Fprintln(out, "Usage:")
-		fmt.Fprintf(out, "  %s commitPush\n", commandName)
+		fmt.Fprintf(out, "  %s commitPush [--offline] [--no-cache] [--resume] [--remote <name>] [--force-with-lease]\n", commandName)
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "Without OPENAI_API_KEY, on model errors, or with --offline, the message is built locally from the diff.")
+		fmt.Fprintln(out, "Messages are cached per staged diff in ~/.flow/cache/commit for 7 days; --no-cache skips the cache.")
+		fmt.Fprintln(out, "If a commit hook rejects the commit, the message is kept; --resume reuses it after you fix the issues.")
+		fmt.Fprintln(out, "New branches get an upstream on first push; rejected pushes offer git pull --rebase and a retry.")
+		fmt.Fprintln(out, "Private forks from privateForkRepo always push to origin, never upstream.")
 		return true
 	case "commitReviewAndPush":
 		fmt.Fprintln(out, "Generate a commit message, review it interactively, commit, and push")
 		fmt.Fprintln(out)
 		fmt.Fprintln(out, "Usage:")
-		fmt.Fprintf(out, "  %s commitReviewAndPush\n", commandName)
+		fmt.Fprintf(out, "  %s commitReviewAndPush [--offline] [--no-cache] [--resume] [--review] [--remote <name>] [--force-with-lease]\n", commandName)
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "Without OPENAI_API_KEY, on model errors, or with --offline, the message is built locally from the diff.")
+		fmt.Fprintln(out, "Messages are cached per staged diff in ~/.flow/cache/commit for 7 days; --no-cache skips the cache.")
+		fmt.Fprintln(out, "If a commit hook rejects the commit, the message is kept; --resume reuses it after you fix the issues.")
+		fmt.Fprintln(out, "New branches get an upstream on first push; rejected pushes offer git pull --rebase and a retry.")
+		fmt.Fprintln(out, "Private forks from privateForkRepo always push to origin, never upstream.")
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "Review keys: y commit, n cancel, e edit, r regenerate (optionally with an instruction),")
+		fmt.Fprintln(out, "s shorten subject, d show diff stat, h pick an earlier candidate.")
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "--review asks the model to review the staged diff first and shows each finding next to its hunk;")
+		fmt.Fprintln(out, "continue, abort, or open a finding in your editor. Reviews are cached per diff in ~/.flow/cache/review.")
+		return true
+	case "commitSplit":
+		fmt.Fprintln(out, "Split the staged changes into several logical commits")
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "Usage:")
+		fmt.Fprintf(out, "  %s commitSplit\n", commandName)
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "Hunks are grouped by GPT-5 nano (or by directory without OPENAI_API_KEY).")
+		fmt.Fprintln(out, "Review or edit the plan before the commits are created; the index is restored on failure.")
+		return true
+	case "reword":
+		fmt.Fprintln(out, "Regenerate the message of an existing commit and rewrite it")
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "Usage:")
+		fmt.Fprintf(out, "  %s reword [rev] [--force] [--offline] [--no-cache]\n", commandName)
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "Defaults to HEAD, which is amended in place. Older commits are rewritten with a rebase;")
+		fmt.Fprintln(out, "commits already on a remote branch are refused unless --force is given.")
+		return true
+	case "uncommit":
+		fmt.Fprintln(out, "Undo the last commit fgo created and restage its changes")
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "Usage:")
+		fmt.Fprintf(out, "  %s uncommit [--yes]\n", commandName)
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "Only commits made by commit, commitPush, commitReviewAndPush or commitSplit are undone.")
+		fmt.Fprintln(out, "The index is restored to exactly what was committed and the message is kept for commit --resume.")
+		fmt.Fprintln(out, "A commit already on a remote branch is reverted with a new commit instead of being reset.")
+		return true
+	case "snapshot":
+		fmt.Fprintln(out, "Save, list, diff or restore working tree snapshots")
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "Usage:")
+		fmt.Fprintf(out, "  %s snapshot [-m <message>]\n", commandName)
+		fmt.Fprintf(out, "  %s snapshot list [branch]\n", commandName)
+		fmt.Fprintf(out, "  %s snapshot diff [n] [--stat]\n", commandName)
+		fmt.Fprintf(out, "  %s snapshot restore [n] [--yes]\n", commandName)
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "Snapshots include untracked files and are stored as commits on refs/flow/snapshots/<branch>;")
+		fmt.Fprintln(out, "HEAD, the index and the stash are untouched. n counts back from the newest (0) or is a commit id.")
+		fmt.Fprintln(out, "uncommit, a gitSyncFork rebase and restore itself take a snapshot first.")
+		return true
+	case "prCreate":
+		fmt.Fprintln(out, "Generate a pull request title and body for the current branch and open it")
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "Usage:")
+		fmt.Fprintf(out, "  %s prCreate [--base <branch>] [--remote <remote>] [--draft] [--offline]\n", commandName)
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "Defaults: base=<remote>/HEAD (or main), remote=upstream when it exists, otherwise origin.")
+		fmt.Fprintln(out, "The branch is pushed where commitPush would push it, usually origin, and opened from there.")
+		fmt.Fprintln(out, "Review the draft with [e] edit, [r] regenerate with an instruction, [d] diff stat or [h] history.")
+		fmt.Fprintln(out, "Fills .github/pull_request_template.md when present. Uses gh, or GITHUB_TOKEN with the REST API.")
+		return true
+	case "usage":
+		fmt.Fprintln(out, "Report AI token usage and estimated cost by day, repo and model")
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "Usage:")
+		fmt.Fprintf(out, "  %s usage [--days <n>]\n", commandName)
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "Defaults to the current month. Every model call is logged to ~/.flow/usage/ledger.jsonl.")
+		fmt.Fprintln(out, "Prices and monthly_budget_usd can be set in ~/.flow/usage/config.json;")
+		fmt.Fprintf(out, "%s overrides the budget. Calls warn once spend reaches 80%% of the budget.\n", monthlyBudgetEnv)
+		return true
+	case "explain":
+		fmt.Fprintln(out, "Explain a commit, range or file history in plain language")
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "Usage:")
+		fmt.Fprintf(out, "  %s explain [<rev|range|path> | --upstream]\n", commandName)
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "Defaults to HEAD. A path explains its last 20 commits. --upstream explains the upstream")
+		fmt.Fprintln(out, "commits the last gitSyncFork of the current branch brought in. The answer streams as it arrives.")
+		return true
+	case "changelog":
+		fmt.Fprintln(out, "Write release notes for a commit range into CHANGELOG.md")
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "Usage:")
+		fmt.Fprintf(out, "  %s changelog [from..to] [--version <name>] [--output <file>] [--json] [--offline]\n", commandName)
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "Defaults to the last tag through HEAD. Commits are grouped by conventional type; others are")
+		fmt.Fprintln(out, "classified by the model (or by their leading verb with --offline). PR numbers link to GitHub.")
+		fmt.Fprintln(out, "The section goes under a new version heading (Unreleased unless --version or a tagged end);")
+		fmt.Fprintln(out, "--json prints the grouped commits instead of writing the file.")
+		return true
+	case "release":
+		fmt.Fprintln(out, "Bump the semver tag, update the changelog and push the tag")
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "Usage:")
+		fmt.Fprintf(out, "  %s release <major|minor|patch> [--remote <name>] [--no-changelog] [--offline] [--dry-run] [--yes]\n", commandName)
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "Bumps the highest vX.Y.Z tag reachable from HEAD and creates an annotated tag with the release")
+		fmt.Fprintf(out, "notes. When the repository has a %s, the new section is committed first.\n", changelogFileName)
+		return true
+	case "protect":
+		fmt.Fprintln(out, "Block pushes to protected remotes with a pre-push hook")
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "Usage:")
+		fmt.Fprintf(out, "  %s protect [<remote|url>...] [--list] [--remove <remote|url>]\n", commandName)
+		fmt.Fprintln(out)
+		fmt.Fprintf(out, "Protects upstream when no remote is named. URLs are stored in git config %s and\n", protectedRemoteKey)
+		fmt.Fprintln(out, "matched regardless of ssh/https form. An existing pre-push hook is kept and run after the check.")
+		fmt.Fprintf(out, "privateForkRepo protects upstream automatically. Set %s=1 to push anyway.\n", allowProtectedEnv)
+		return true
+	case "pair":
+		fmt.Fprintln(out, "Add Co-authored-by trailers for a pairing session")
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "Usage:")
+		fmt.Fprintf(out, "  %s pair [<alias>...] [--clear]\n", commandName)
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "Aliases resolve through git config flow.pair.<alias> (\"Name <email>\"), a literal")
+		fmt.Fprintln(out, "\"Name <email>\", or a unique author in the repository history. Without aliases the")
+		fmt.Fprintf(out, "current session is shown; sessions expire after %.0f hours.\n", pairSessionTTL.Hours())
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "Commits created by fgo also get a Refs: trailer from the ticket id in the branch name")
+		fmt.Fprintln(out, "(ABC-123, or #123 for a leading number; override with flow.ticketPattern and")
+		fmt.Fprintln(out, "flow.ticketTrailer) and a Signed-off-by trailer when the repository uses a DCO (or")
+		fmt.Fprintln(out, "flow.signoff is true).")
 		return true
 	case "branchFromClipboard":
 		fmt.Fprintln(out, "Create a git branch from the clipboard name")
@@ -502,11 +718,48 @@ func printCommandHelp(name string, out io.Writer) bool {
 		fmt.Fprintln(out)
 		fmt.Fprintln(out, "Without an argument the command uses the frontmost Safari tab URL.")
 		return true
+	case "worktree":
+		fmt.Fprintln(out, "List, open, remove or prune branch worktrees")
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "Usage:")
+		fmt.Fprintf(out, "  %s worktree [list]\n", commandName)
+		fmt.Fprintf(out, "  %s worktree open [branch]\n", commandName)
+		fmt.Fprintf(out, "  %s worktree remove [branch] [--force]\n", commandName)
+		fmt.Fprintf(out, "  %s worktree prune [--dry-run] [--yes]\n", commandName)
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "open and remove show a fuzzy picker without a branch. prune removes worktrees whose branch is")
+		fmt.Fprintln(out, "merged into the default branch, or squash-merged with its upstream gone, along with the branch;")
+		fmt.Fprintln(out, "worktrees with uncommitted changes or unmerged commits are kept. Create worktrees with")
+		fmt.Fprintln(out, "gitCheckout --worktree.")
+		return true
+	case "stack":
+		fmt.Fprintln(out, "Track stacked branches, restack them onto their parents and push them")
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "Usage:")
+		fmt.Fprintf(out, "  %s stack [show]\n", commandName)
+		fmt.Fprintf(out, "  %s stack new <branch>\n", commandName)
+		fmt.Fprintf(out, "  %s stack track [parent]\n", commandName)
+		fmt.Fprintf(out, "  %s stack untrack [branch]\n", commandName)
+		fmt.Fprintf(out, "  %s stack restack [--continue|--abort]\n", commandName)
+		fmt.Fprintf(out, "  %s stack push [--remote <remote>]\n", commandName)
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "Parents are stored as branch.<name>.flowParent in git config; track defaults to the default branch.")
+		fmt.Fprintln(out, "restack rebases every branch in the current stack whose parent moved with rebase --onto, parents")
+		fmt.Fprintln(out, "first, and pauses on conflicts until --continue. push force-pushes each branch with --force-with-lease.")
+		return true
 	case "gitCheckout":
 		fmt.Fprintln(out, "Check out a branch from the remote, creating a local tracking branch if needed")
 		fmt.Fprintln(out)
 		fmt.Fprintln(out, "Usage:")
-		fmt.Fprintf(out, "  %s gitCheckout [branch-or-url]\n", commandName)
+		fmt.Fprintf(out, "  %s gitCheckout [branch-or-url] [--worktree [--open]]\n", commandName)
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "--worktree checks the branch out in <repo>.worktrees/<branch> instead of switching in place;")
+		fmt.Fprintln(out, "--open then opens that directory in your editor.")
+		fmt.Fprintln(out, "Accepts a branch, remote/branch, owner:branch, or a GitHub /tree/, /pull/<n> or /compare/ URL.")
+		fmt.Fprintln(out, "Branches on forks get a remote named after the owner and a local branch named owner/branch.")
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "Without an argument, pick from local and remote branches (newest first) with fuzzy finder;")
+		fmt.Fprintln(out, "the preview shows the last commit and how far each branch is ahead of or behind the default branch.")
 		return true
 	case "killPort":
 		fmt.Fprintln(out, "Kill a process by the port it listens on, optionally with fuzzy finder")
@@ -528,13 +781,29 @@ func printCommandHelp(name string, out io.Writer) bool {
 		fmt.Fprintln(out)
 		fmt.Fprintln(out, "Defaults to fetching from the upstream remote with pruning.")
 		return true
+	case "gitCleanup":
+		fmt.Fprintln(out, "Delete local branches that are merged, squash-merged or whose upstream is gone")
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "Usage:")
+		fmt.Fprintf(out, "  %s gitCleanup [--dry-run]\n", commandName)
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "Branches are compared with the default branch; squash merges are found by patch id. Pick the")
+		fmt.Fprintln(out, "ones to delete in the fuzzy finder (tab selects several). The current branch, branches checked")
+		fmt.Fprintf(out, "out in a worktree, main, master, develop, trunk and names or globs in git config %s\n", protectedBranchKey)
+		fmt.Fprintln(out, "are never offered. Run gitFetchUpstream first so deleted upstream branches show as gone.")
+		return true
 	case "gitSyncFork":
 		fmt.Fprintln(out, "Rebase or merge your local branch with upstream/<branch>")
 		fmt.Fprintln(out)
 		fmt.Fprintln(out, "Usage:")
-		fmt.Fprintf(out, "  %s gitSyncFork [--branch <name>] [--strategy rebase|merge] [--remote <remote>]\n", commandName)
+		fmt.Fprintf(out, "  %s gitSyncFork [--branch <name> | --all-tracked] [--strategy rebase|merge] [--remote <remote>] [--autostash] [--push]\n", commandName)
+		fmt.Fprintf(out, "  %s gitSyncFork --continue | --abort\n", commandName)
 		fmt.Fprintln(out)
 		fmt.Fprintln(out, "Defaults: branch=current (or origin/HEAD), strategy=rebase, remote=upstream.")
+		fmt.Fprintln(out, "--all-tracked syncs every local branch that also exists on the remote. A dirty working tree is")
+		fmt.Fprintln(out, "refused unless --autostash is given. On a conflict the sync stops; resolve it and run --continue,")
+		fmt.Fprintln(out, "or --abort to stop there. --push pushes each synced branch to origin, with --force-with-lease after")
+		fmt.Fprintln(out, "a rebase. A table of each branch's result and before/after commits is printed at the end.")
 		return true
 	case "youtubeToSound":
 		fmt.Fprintln(out, "Download audio from a YouTube URL into ~/.flow/youtube-sound using yt-dlp")
@@ -582,13 +851,27 @@ func printRootHelp(out io.Writer) {
 	fmt.Fprintln(out, "  commit           Generate a commit message with GPT-5 nano and create the commit")
 	fmt.Fprintln(out, "  commitPush       Generate a commit message, commit, and push to the default remote")
 	fmt.Fprintln(out, "  commitReviewAndPush Generate a commit message, review it interactively, commit, and push")
+	fmt.Fprintln(out, "  commitSplit      Split the staged changes into several logical commits")
+	fmt.Fprintln(out, "  reword           Regenerate the message of an existing commit and rewrite it")
+	fmt.Fprintln(out, "  uncommit         Undo the last commit fgo created and restage its changes")
+	fmt.Fprintln(out, "  snapshot         Save, list, diff or restore working tree snapshots")
+	fmt.Fprintln(out, "  prCreate         Generate a pull request title and body for the current branch and open it")
+	fmt.Fprintln(out, "  usage            Report AI token usage and estimated cost by day, repo and model")
+	fmt.Fprintln(out, "  explain          Explain a commit, range or file history in plain language")
+	fmt.Fprintln(out, "  changelog        Write release notes for a commit range into CHANGELOG.md")
+	fmt.Fprintln(out, "  release          Bump the semver tag, update the changelog and push the tag")
+	fmt.Fprintln(out, "  protect          Block pushes to protected remotes with a pre-push hook")
+	fmt.Fprintln(out, "  pair             Add Co-authored-by trailers for a pairing session")
 	fmt.Fprintln(out, "  branchFromClipboard Create a git branch from the clipboard name")
 	fmt.Fprintln(out, "  clone            Clone a GitHub repository into ~/gh/<owner>/<repo>")
 	fmt.Fprintln(out, "  cloneAndOpen     Clone a GitHub repository and open it in Cursor (Safari tab optional)")
 	fmt.Fprintln(out, "  gitCheckout      Check out a branch from the remote, creating a local tracking branch if needed")
+	fmt.Fprintln(out, "  worktree         List, open, remove or prune branch worktrees")
+	fmt.Fprintln(out, "  stack            Track stacked branches, restack them onto their parents and push them")
 	fmt.Fprintln(out, "  killPort         Kill a process by the port it listens on, optionally with fuzzy finder")
 	fmt.Fprintln(out, "  privateForkRepo  Clone a repo and create a private fork with upstream remotes")
 	fmt.Fprintln(out, "  gitFetchUpstream Fetch from upstream (or all remotes) with pruning")
+	fmt.Fprintln(out, "  gitCleanup       Delete local branches that are merged, squash-merged or whose upstream is gone")
 	fmt.Fprintln(out, "  gitSyncFork      Update a local branch from upstream using rebase or merge")
 	fmt.Fprintln(out, "  updateGoVersion  Upgrade Go using the workspace script")
 	fmt.Fprintln(out, "  youtubeToSound   Download audio from a YouTube URL into ~/.flow/youtube-sound using yt-dlp")
@@ -1155,21 +1438,29 @@ end tell`
 type commitPayload struct {
 	message    string
 	paragraphs []string
+	diff       string
+	status     string
+	truncated  bool
+	style      *commitStyle
+	source     commitDiffSource
+	cacheKey   string
+	candidates []string
 }
 
 func runCommit(ctx *snap.Context) error {
-	if ctx.NArgs() != 0 {
-		return reportError(ctx, fmt.Errorf("Usage: %s commit", commandName))
+	opts, err := parseCommitOptions(ctx, "commit", false)
+	if err != nil {
+		return err
 	}
 
-	payload, err := prepareCommit(ctx)
+	payload, err := prepareCommit(ctx, opts)
 	if err != nil {
 		return err
 	}
 
 	printProposedMessage(ctx, payload.message)
 	if err := commitWithPayload(ctx, payload); err != nil {
-		return err
+		return reportError(ctx, err)
 	}
 
 	printCommitSuccess(ctx, payload)
@@ -1177,23 +1468,27 @@ func runCommit(ctx *snap.Context) error {
 }
 
 func runCommitPush(ctx *snap.Context) error {
-	if ctx.NArgs() != 0 {
-		return reportError(ctx, fmt.Errorf("Usage: %s commitPush", commandName))
+	opts, err := parseCommitOptions(ctx, "commitPush", true)
+	if err != nil {
+		return err
+	}
+	if err := checkPushTarget(opts.push); err != nil {
+		return reportError(ctx, err)
 	}
 
-	payload, err := prepareCommit(ctx)
+	payload, err := prepareCommit(ctx, opts)
 	if err != nil {
 		return err
 	}
 
 	printProposedMessage(ctx, payload.message)
 	if err := commitWithPayload(ctx, payload); err != nil {
-		return err
+		return reportError(ctx, err)
 	}
 	printCommitSuccess(ctx, payload)
 
-	if err := runGitCommandStreaming(ctx, "push"); err != nil {
-		return reportError(ctx, fmt.Errorf("git push: %w", err))
+	if err := pushCurrentBranch(ctx, opts.push); err != nil {
+		return reportError(ctx, err)
 	}
 
 	fmt.Fprintln(ctx.Stdout(), "✔️ Pushed")
@@ -1201,16 +1496,34 @@ func runCommitPush(ctx *snap.Context) error {
 }
 
 func runCommitReviewAndPush(ctx *snap.Context) error {
-	if ctx.NArgs() != 0 {
-		return reportError(ctx, fmt.Errorf("Usage: %s commitReviewAndPush", commandName))
+	opts, err := parseCommitOptions(ctx, "commitReviewAndPush", true)
+	if err != nil {
+		return err
+	}
+	if err := checkPushTarget(opts.push); err != nil {
+		return reportError(ctx, err)
+	}
+
+	if opts.review {
+		if err := ensureGitRepository(); err != nil {
+			return err
+		}
+		proceed, err := reviewStagedChanges(ctx, opts)
+		if err != nil {
+			return reportError(ctx, err)
+		}
+		if !proceed {
+			fmt.Fprintln(ctx.Stdout(), "Commit cancelled after review.")
+			return nil
+		}
 	}
 
-	payload, err := prepareCommit(ctx)
+	payload, err := prepareCommit(ctx, opts)
 	if err != nil {
 		return err
 	}
 
-	updatedMessage, confirmed, err := promptCommitConfirmation(ctx, payload.message)
+	updatedMessage, confirmed, err := promptCommitConfirmation(ctx, payload)
 	if err != nil {
 		return reportError(ctx, err)
 	}
@@ -1221,40 +1534,88 @@ func runCommitReviewAndPush(ctx *snap.Context) error {
 	}
 
 	if updatedMessage != payload.message {
-		trimmed := strings.TrimSpace(updatedMessage)
-		if trimmed == "" {
-			return reportError(ctx, fmt.Errorf("commit message is empty after editing"))
-		}
-		paragraphs := splitCommitMessageParagraphs(trimmed)
-		if len(paragraphs) == 0 {
-			return reportError(ctx, fmt.Errorf("commit message is empty after formatting"))
+		if err := payload.setMessage(updatedMessage); err != nil {
+			return reportError(ctx, err)
 		}
-		payload.message = trimmed
-		payload.paragraphs = paragraphs
 	}
 
 	printProposedMessage(ctx, payload.message)
 	if err := commitWithPayload(ctx, payload); err != nil {
-		return err
+		return reportError(ctx, err)
 	}
 	printCommitSuccess(ctx, payload)
 
-	if err := runGitCommandStreaming(ctx, "push"); err != nil {
-		return reportError(ctx, fmt.Errorf("git push: %w", err))
+	if err := pushCurrentBranch(ctx, opts.push); err != nil {
+		return reportError(ctx, err)
 	}
 
 	fmt.Fprintln(ctx.Stdout(), "✔️ Pushed")
 	return nil
 }
 
-func prepareCommit(ctx *snap.Context) (*commitPayload, error) {
-	if err := ensureGitRepository(); err != nil {
-		return nil, err
+type commitOptions struct {
+	offline bool
+	noCache bool
+	resume  bool
+	review  bool
+	push    pushOptions
+}
+
+// parseCommitOptions parses the flags shared by the commit commands; the push
+// flags are only accepted when withPush is set.
+func parseCommitOptions(ctx *snap.Context, name string, withPush bool) (commitOptions, error) {
+	var opts commitOptions
+	usage := fmt.Sprintf("Usage: %s %s [--offline] [--no-cache] [--resume]", commandName, name)
+	withReview := name == "commitReviewAndPush"
+	if withReview {
+		usage += " [--review]"
+	}
+	if withPush {
+		usage += " [--remote <name>] [--force-with-lease]"
 	}
 
-	apiKey, err := resolveOpenAIKey(ctx.Context())
-	if err != nil {
-		return nil, reportError(ctx, err)
+	for i := 0; i < ctx.NArgs(); i++ {
+		arg := strings.TrimSpace(ctx.Arg(i))
+		if arg == "" {
+			continue
+		}
+
+		switch {
+		case arg == "--offline":
+			opts.offline = true
+		case arg == "--no-cache":
+			opts.noCache = true
+		case arg == "--resume":
+			opts.resume = true
+		case withReview && arg == "--review":
+			opts.review = true
+		case withPush && arg == "--force-with-lease":
+			opts.push.forceWithLease = true
+		case withPush && arg == "--remote":
+			i++
+			if i >= ctx.NArgs() || strings.TrimSpace(ctx.Arg(i)) == "" {
+				fmt.Fprintln(ctx.Stderr(), usage)
+				return opts, fmt.Errorf("--remote requires a value")
+			}
+			opts.push.remote = strings.TrimSpace(ctx.Arg(i))
+		case withPush && strings.HasPrefix(arg, "--remote="):
+			opts.push.remote = strings.TrimSpace(strings.TrimPrefix(arg, "--remote="))
+			if opts.push.remote == "" {
+				fmt.Fprintln(ctx.Stderr(), usage)
+				return opts, fmt.Errorf("--remote requires a value")
+			}
+		default:
+			fmt.Fprintln(ctx.Stderr(), usage)
+			return opts, fmt.Errorf("unexpected argument %q", arg)
+		}
+	}
+
+	return opts, nil
+}
+
+func prepareCommit(ctx *snap.Context, opts commitOptions) (*commitPayload, error) {
+	if err := ensureGitRepository(); err != nil {
+		return nil, err
 	}
 
 	if err := runGitCommandStreaming(ctx, "add", "."); err != nil {
@@ -1271,20 +1632,102 @@ func prepareCommit(ctx *snap.Context) (*commitPayload, error) {
 		return nil, reportError(ctx, fmt.Errorf("no staged changes to commit; stage files with git add"))
 	}
 
-	trimmedDiff, truncated := truncateDiffForCommit(diff)
-
 	statusOutput, statusErr := exec.Command("git", "status", "--short").CombinedOutput()
 	status := ""
 	if statusErr == nil {
 		status = string(statusOutput)
 	}
 
-	message, err := generateCommitMessage(ctx.Context(), apiKey, trimmedDiff, status, truncated)
+	if opts.resume {
+		return resumeCommitPayload(ctx, diff, status)
+	}
+	return generateCommitPayload(ctx, opts, stagedDiffSource, diff, status)
+}
+
+// resumeCommitPayload reuses the message saved when a commit hook rejected
+// the previous attempt.
+func resumeCommitPayload(ctx *snap.Context, diff string, status string) (*commitPayload, error) {
+	message, err := loadCommitResume()
 	if err != nil {
 		return nil, reportError(ctx, err)
 	}
 
-	message = strings.TrimSpace(trimMatchingQuotes(message))
+	trimmedDiff, truncated := truncateDiffForCommit(diff)
+	payload := &commitPayload{
+		diff:      trimmedDiff,
+		status:    status,
+		truncated: truncated,
+		style:     learnCommitStyle(),
+		source:    stagedDiffSource,
+	}
+	if err := payload.setMessage(message); err != nil {
+		return nil, reportError(ctx, err)
+	}
+
+	fmt.Fprintln(ctx.Stdout(), "ℹ️ Resuming with the saved commit message")
+	return payload, nil
+}
+
+func generateCommitPayload(ctx *snap.Context, opts commitOptions, source commitDiffSource, diff string, status string) (*commitPayload, error) {
+	trimmedDiff, truncated := truncateDiffForCommit(diff)
+
+	payload := &commitPayload{
+		diff:      trimmedDiff,
+		status:    status,
+		truncated: truncated,
+		style:     learnCommitStyle(),
+		source:    source,
+	}
+	if !opts.offline && !opts.noCache {
+		payload.cacheKey = commitCacheKey(diff)
+	}
+
+	var (
+		message string
+		err     error
+	)
+	if payload.cacheKey != "" {
+		if entry, err := loadCommitCache(payload.cacheKey); err == nil && entry != nil {
+			fmt.Fprintf(ctx.Stdout(), "ℹ️ Using cached commit message from %s (pass --no-cache to regenerate)\n", entry.Created.Local().Format("Jan 2 15:04"))
+			payload.candidates = entry.Candidates
+			message = entry.Candidates[len(entry.Candidates)-1]
+		}
+	}
+
+	if message == "" && !opts.offline {
+		if apiKey, keyErr := resolveOpenAIKey(ctx.Context()); keyErr != nil {
+			fmt.Fprintf(ctx.Stderr(), "%v; using an offline commit message instead.\n", keyErr)
+		} else {
+			message, err = generateCommitMessage(ctx.Context(), apiKey, payload)
+			switch {
+			case errors.Is(err, errGenerationInterrupted):
+				edited, editErr := offerPartialMessage(ctx, message)
+				if editErr != nil {
+					return nil, reportError(ctx, editErr)
+				}
+				// A partial or hand-edited message stays out of the diff
+				// cache so the next run does not reuse it as generated.
+				message = edited
+				if message == "" {
+					fmt.Fprintln(ctx.Stderr(), "Using an offline commit message instead.")
+				}
+			case err != nil:
+				fmt.Fprintf(ctx.Stderr(), "%v; using an offline commit message instead.\n", err)
+				message = ""
+			default:
+				message = strings.TrimSpace(payload.style.format(strings.TrimSpace(trimMatchingQuotes(message))))
+				payload.rememberCandidate(message)
+			}
+		}
+	}
+	if message == "" {
+		message, err = generateOfflineCommitMessage(source)
+		if err != nil {
+			return nil, reportError(ctx, err)
+		}
+	}
+
+	message = strings.TrimSpace(payload.style.format(strings.TrimSpace(trimMatchingQuotes(message))))
 	if message == "" {
 		return nil, reportError(ctx, fmt.Errorf("commit message is empty"))
 	}
@@ -1293,24 +1736,14 @@ func prepareCommit(ctx *snap.Context) (*commitPayload, error) {
 		return nil, reportError(ctx, fmt.Errorf("commit message is empty after formatting"))
 	}
 
-	return &commitPayload{message: message, paragraphs: paragraphs}, nil
+	payload.message = message
+	payload.paragraphs = paragraphs
+	return payload, nil
 }
 
 func commitWithPayload(ctx *snap.Context, payload *commitPayload) error {
-	args := []string{"commit"}
-	for _, paragraph := range payload.paragraphs {
-		args = append(args, "-m", paragraph)
-	}
-
-	cmd := exec.Command("git", args...)
-	cmd.Stdout = ctx.Stdout()
-	cmd.Stderr = ctx.Stderr()
-	cmd.Stdin = ctx.Stdin()
-	if err := cmd.Run(); err != nil {
-		return reportError(ctx, fmt.Errorf("git commit: %w", err))
-	}
-
-	return nil
+	payload.applyTrailers(ctx, commitTrailers())
+	return runCommitHooked(ctx, payload)
 }
 
 func printProposedMessage(ctx *snap.Context, message string) {
@@ -1324,43 +1757,104 @@ func printCommitSuccess(ctx *snap.Context, payload *commitPayload) {
 	fmt.Fprintf(ctx.Stdout(), "✔️ Committed with message: %s\n", payload.paragraphs[0])
 }
 
-func promptCommitConfirmation(ctx *snap.Context, message string) (string, bool, error) {
-	current := message
+func promptCommitConfirmation(ctx *snap.Context, payload *commitPayload) (string, bool, error) {
+	candidates := []string{payload.message}
+	current := 0
+	if len(payload.candidates) > 0 {
+		candidates = append([]string(nil), payload.candidates...)
+		current = len(candidates) - 1
+		for i, candidate := range candidates {
+			if candidate == payload.message {
+				current = i
+			}
+		}
+	}
 
-	for {
-		fmt.Fprintln(ctx.Stdout(), strings.Repeat("─", 60))
-		fmt.Fprintln(ctx.Stdout(), "Review commit message:")
-		fmt.Fprintln(ctx.Stdout(), strings.Repeat("─", 60))
-		fmt.Fprintln(ctx.Stdout(), current)
-		fmt.Fprintln(ctx.Stdout(), strings.Repeat("─", 60))
-		fmt.Fprintln(ctx.Stdout(), "Options: [y] commit  [n] cancel  [e] edit message")
-		fmt.Fprint(ctx.Stdout(), "Choice [y/n/e]: ")
-
-		choice, err := readConfirmationChoice(ctx)
-		if err != nil {
-			return "", false, fmt.Errorf("reading choice: %w", err)
-		}
-
-		switch strings.ToLower(string(choice)) {
-		case "y":
-			return current, true, nil
-		case "n":
-			return current, false, nil
-		case "e":
-			edited, err := editCommitMessage(ctx, current)
-			if err != nil {
-				return "", false, fmt.Errorf("edit commit message: %w", err)
+	return reviewGeneratedText(ctx, textReview{
+		noun:        "commit message",
+		acceptLabel: "commit",
+		editLabel:   "edit message",
+		regenerate: func(current, instruction string) (string, error) {
+			message, err := regenerateCommitMessage(ctx, payload, current, instruction)
+			if err == nil {
+				payload.rememberCandidate(message)
 			}
-			trimmed := strings.TrimSpace(edited)
-			if trimmed == "" {
-				fmt.Fprintln(ctx.Stdout(), "Edited message is empty; keeping previous message.")
-				continue
+			return message, err
+		},
+		shortenLabel:       "shorten subject",
+		shortenInstruction: "Shorten the subject line to at most 50 characters while keeping its meaning. Keep the body unchanged.",
+		showDiff: func() {
+			statArgs := append([]string{"diff", "--stat"}, payload.source.diffArgs...)
+			if err := runGitCommandStreaming(ctx, statArgs...); err != nil {
+				fmt.Fprintf(ctx.Stderr(), "git %s: %v\n", strings.Join(statArgs, " "), err)
 			}
-			current = trimmed
-		default:
-			fmt.Fprintln(ctx.Stdout(), "Please choose y, n, or e.")
+		},
+	}, candidates, current)
+}
+
+func selectCommitCandidate(ctx *snap.Context, candidates []string, current int) (int, error) {
+	for i, candidate := range candidates {
+		marker := " "
+		if i == current {
+			marker = "*"
+		}
+		subject := candidate
+		if idx := strings.IndexByte(subject, '\n'); idx >= 0 {
+			subject = subject[:idx]
 		}
+		fmt.Fprintf(ctx.Stdout(), "%s %d. %s\n", marker, i+1, subject)
 	}
+
+	input, err := promptLine(ctx, "Candidate number (Enter to keep current): ")
+	if err != nil {
+		return current, fmt.Errorf("read candidate number: %w", err)
+	}
+	if input == "" {
+		return current, nil
+	}
+
+	number, err := strconv.Atoi(input)
+	if err != nil || number < 1 || number > len(candidates) {
+		fmt.Fprintf(ctx.Stdout(), "Expected a number between 1 and %d; keeping current message.\n", len(candidates))
+		return current, nil
+	}
+
+	return number - 1, nil
+}
+
+func regenerateCommitMessage(ctx *snap.Context, payload *commitPayload, previous string, feedback string) (string, error) {
+	apiKey, err := resolveOpenAIKey(ctx.Context())
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Fprintf(ctx.Stdout(), "ℹ️ Regenerating with %s...\n", commitModelName)
+
+	var userPrompt strings.Builder
+	userPrompt.WriteString(buildCommitUserPrompt(payload))
+	userPrompt.WriteString("\n\nPrevious commit message:\n")
+	userPrompt.WriteString(previous)
+	if trimmed := strings.TrimSpace(feedback); trimmed != "" {
+		userPrompt.WriteString("\n\nRevise the previous commit message following this instruction: ")
+		userPrompt.WriteString(trimmed)
+	} else {
+		userPrompt.WriteString("\n\nWrite a different, improved commit message for the same changes.")
+	}
+
+	message, err := streamChatCompletion(ctx.Context(), apiKey, commitSystemPrompt, userPrompt.String(), streamPreview, nil)
+	if errors.Is(err, errGenerationInterrupted) {
+		return strings.TrimSpace(trimMatchingQuotes(message)), err
+	}
+	if err != nil {
+		return "", fmt.Errorf("regenerate commit message: %w", err)
+	}
+
+	message = strings.TrimSpace(payload.style.format(strings.TrimSpace(trimMatchingQuotes(message))))
+	if message == "" {
+		return "", fmt.Errorf("model returned an empty commit message")
+	}
+
+	return message, nil
 }
 
 func editCommitMessage(ctx *snap.Context, current string) (string, error) {
@@ -1483,27 +1977,46 @@ func reportError(ctx *snap.Context, err error) error {
 	return err
 }
 
-func generateCommitMessage(parent context.Context, apiKey string, diff string, status string, truncated bool) (string, error) {
-	client := openai.NewClient(option.WithAPIKey(apiKey))
+const commitSystemPrompt = "You are an expert software engineer who writes clear, concise git commit messages. Use imperative mood, keep the subject line under 72 characters, and include an optional body with bullet points if helpful. Never wrap the message in quotes. Never include secrets, credentials, or file contents from .env files, environment variables, keys, or other sensitive data—even if they appear in the diff."
 
-	requestCtx, cancel := context.WithTimeout(parent, 45*time.Second)
-	defer cancel()
+func generateCommitMessage(parent context.Context, apiKey string, payload *commitPayload) (string, error) {
+	message, err := streamChatCompletion(parent, apiKey, commitSystemPrompt, buildCommitUserPrompt(payload), streamPreview, nil)
+	if errors.Is(err, errGenerationInterrupted) {
+		return message, err
+	}
+	if err != nil {
+		return "", fmt.Errorf("generate commit message: %w", err)
+	}
 
-	systemPrompt := "You are an expert software engineer who writes clear, concise git commit messages. Use imperative mood, keep the subject line under 72 characters, and include an optional body with bullet points if helpful. Never wrap the message in quotes. Never include secrets, credentials, or file contents from .env files, environment variables, keys, or other sensitive data—even if they appear in the diff."
+	return message, nil
+}
 
+func buildCommitUserPrompt(payload *commitPayload) string {
 	var userPromptBuilder strings.Builder
 	userPromptBuilder.WriteString("Write a git commit message for the staged changes.\n\nGit diff:\n")
-	userPromptBuilder.WriteString(diff)
-	if truncated {
+	userPromptBuilder.WriteString(payload.diff)
+	if payload.truncated {
 		userPromptBuilder.WriteString("\n\n[Diff truncated to fit within prompt]")
 	}
-
-	if s := strings.TrimSpace(status); s != "" {
+	if s := strings.TrimSpace(payload.status); s != "" {
 		userPromptBuilder.WriteString("\n\nGit status --short:\n")
 		userPromptBuilder.WriteString(s)
 	}
+	if section := payload.style.promptSection(); section != "" {
+		userPromptBuilder.WriteString("\n\n")
+		userPromptBuilder.WriteString(section)
+	}
+	return userPromptBuilder.String()
+}
+
+// requestChatCompletion sends a single prompt and returns the whole answer,
+// showing a spinner while it streams in.
+func requestChatCompletion(parent context.Context, apiKey string, systemPrompt string, userPrompt string) (string, error) {
+	return streamChatCompletion(parent, apiKey, systemPrompt, userPrompt, streamSpinner, nil)
+}
 
-	resp, err := client.Chat.Completions.New(requestCtx, openai.ChatCompletionNewParams{
+func chatCompletionParams(systemPrompt string, userPrompt string) openai.ChatCompletionNewParams {
+	return openai.ChatCompletionNewParams{
 		Model: shared.ChatModel(commitModelName),
 		Messages: []openai.ChatCompletionMessageParamUnion{
 			{
@@ -1513,25 +2026,11 @@ func generateCommitMessage(parent context.Context, apiKey string, diff string, s
 			},
 			{
 				OfUser: &openai.ChatCompletionUserMessageParam{
-					Content: openai.ChatCompletionUserMessageParamContentUnion{OfString: openai.String(userPromptBuilder.String())},
+					Content: openai.ChatCompletionUserMessageParamContentUnion{OfString: openai.String(userPrompt)},
 				},
 			},
 		},
-	})
-	if err != nil {
-		return "", fmt.Errorf("generate commit message: %w", err)
-	}
-
-	if resp == nil || len(resp.Choices) == 0 {
-		return "", fmt.Errorf("model returned no commit message choices")
 	}
-
-	message := strings.TrimSpace(resp.Choices[0].Message.Content)
-	if message == "" {
-		return "", fmt.Errorf("model returned an empty commit message")
-	}
-
-	return message, nil
 }
 
 func truncateDiffForCommit(diff string) (string, bool) {
@@ -1720,6 +2219,13 @@ func runPrivateForkRepo(ctx *snap.Context) error {
 		return reportError(ctx, fmt.Errorf("git remote add origin %s: %w", privateSSH, err))
 	}
 
+	if _, err := protectRemote(targetDir, "upstream"); err != nil {
+		return reportError(ctx, err)
+	}
+	if err := installPrePushHook(targetDir); err != nil {
+		return reportError(ctx, fmt.Errorf("install pre-push hook: %w", err))
+	}
+
 	taskfileCreated, err := ensureTaskfile(targetDir, owner, repo, login, privateRepoName)
 	if err != nil {
 		return reportError(ctx, fmt.Errorf("prepare Taskfile.yml: %w", err))
@@ -1727,7 +2233,7 @@ func runPrivateForkRepo(ctx *snap.Context) error {
 
 	fmt.Fprintf(ctx.Stdout(), "✔️ Local copy: %s\n", targetDir)
 	fmt.Fprintf(ctx.Stdout(), "✔️ origin -> %s\n", privateSSH)
-	fmt.Fprintf(ctx.Stdout(), "✔️ upstream -> %s\n", cloneURL)
+	fmt.Fprintf(ctx.Stdout(), "✔️ upstream -> %s (pushes blocked by a pre-push hook)\n", cloneURL)
 	fmt.Fprintf(ctx.Stdout(), "ℹ️ Private repo name: %s/%s\n", login, privateRepoName)
 	taskfileLocation := filepath.Join(targetDir, "Taskfile.yml")
 	if taskfileCreated {
@@ -1907,147 +2413,50 @@ func runGitFetchUpstream(ctx *snap.Context) error {
 	return nil
 }
 
-func runGitSyncFork(ctx *snap.Context) error {
-	if err := ensureGitRepository(); err != nil {
-		return err
-	}
-
-	branch := ""
-	strategy := "rebase"
-	remote := "upstream"
-
+func runGitCheckout(ctx *snap.Context) error {
+	var (
+		branchInput string
+		opts        checkoutOptions
+		err         error
+	)
 	for i := 0; i < ctx.NArgs(); i++ {
 		arg := strings.TrimSpace(ctx.Arg(i))
-		if arg == "" {
-			continue
-		}
-
 		switch {
-		case arg == "--branch":
-			i++
-			if i >= ctx.NArgs() {
-				fmt.Fprintf(ctx.Stderr(), "Usage: %s gitSyncFork [--branch <name>] [--strategy rebase|merge] [--remote <remote>]\n", commandName)
-				return fmt.Errorf("--branch requires a value")
-			}
-			branch = strings.TrimSpace(ctx.Arg(i))
-		case strings.HasPrefix(arg, "--branch="):
-			branch = strings.TrimSpace(strings.TrimPrefix(arg, "--branch="))
-		case arg == "--strategy":
-			i++
-			if i >= ctx.NArgs() {
-				fmt.Fprintf(ctx.Stderr(), "Usage: %s gitSyncFork [--branch <name>] [--strategy rebase|merge] [--remote <remote>]\n", commandName)
-				return fmt.Errorf("--strategy requires a value")
-			}
-			strategy = strings.TrimSpace(ctx.Arg(i))
-		case strings.HasPrefix(arg, "--strategy="):
-			strategy = strings.TrimSpace(strings.TrimPrefix(arg, "--strategy="))
-		case arg == "--remote":
-			i++
-			if i >= ctx.NArgs() {
-				fmt.Fprintf(ctx.Stderr(), "Usage: %s gitSyncFork [--branch <name>] [--strategy rebase|merge] [--remote <remote>]\n", commandName)
-				return fmt.Errorf("--remote requires a value")
-			}
-			remote = strings.TrimSpace(ctx.Arg(i))
-		case strings.HasPrefix(arg, "--remote="):
-			remote = strings.TrimSpace(strings.TrimPrefix(arg, "--remote="))
+		case arg == "":
+		case arg == "--worktree":
+			opts.worktree = true
+		case arg == "--open":
+			opts.open = true
+		case branchInput == "" && !strings.HasPrefix(arg, "--"):
+			branchInput = arg
 		default:
-			fmt.Fprintf(ctx.Stderr(), "Usage: %s gitSyncFork [--branch <name>] [--strategy rebase|merge] [--remote <remote>]\n", commandName)
+			fmt.Fprintf(ctx.Stderr(), "Usage: %s gitCheckout [branch-or-url] [--worktree [--open]]\n", commandName)
 			return fmt.Errorf("unexpected argument %q", arg)
 		}
 	}
-
-	if remote == "" {
-		return fmt.Errorf("remote cannot be empty")
-	}
-
-	exists, _, err := gitRemoteState(remote)
-	if err != nil {
-		return err
-	}
-	if !exists {
-		return fmt.Errorf("git remote %q not found", remote)
-	}
-
-	if branch == "" {
-		branch = detectDefaultBranch()
-	}
-	if strings.TrimSpace(branch) == "" || branch == "HEAD" {
-		return fmt.Errorf("could not determine branch to sync; provide one with --branch")
-	}
-
-	if err := runGitCommandStreaming(ctx, "fetch", remote, "--prune"); err != nil {
-		return fmt.Errorf("git fetch %s --prune: %w", remote, err)
-	}
-
-	remoteRef := fmt.Sprintf("%s/%s", remote, branch)
-	hasRemoteBranch, err := gitRefExists(remoteRef)
-	if err != nil {
-		return fmt.Errorf("check remote branch %s: %w", remoteRef, err)
-	}
-	if !hasRemoteBranch {
-		return fmt.Errorf("remote branch %s not found", remoteRef)
-	}
-
-	localExists, err := gitRefExists(branch)
-	if err != nil {
-		return fmt.Errorf("check local branch %s: %w", branch, err)
+	if opts.open && !opts.worktree {
+		fmt.Fprintf(ctx.Stderr(), "Usage: %s gitCheckout [branch-or-url] [--worktree [--open]]\n", commandName)
+		return fmt.Errorf("--open requires --worktree")
 	}
 
-	createdBranch := false
-	if !localExists {
-		if err := runGitCommandStreaming(ctx, "checkout", "-b", branch, remoteRef); err != nil {
-			return fmt.Errorf("git checkout -b %s %s: %w", branch, remoteRef, err)
+	if branchInput == "" && stdinIsTerminal() {
+		if err := ensureGitRepository(); err != nil {
+			return err
 		}
-		createdBranch = true
-	} else {
-		current, err := currentGitBranch()
+		picked, err := pickCheckoutBranch()
 		if err != nil {
 			return err
 		}
-		if current != branch {
-			if err := runGitCommandStreaming(ctx, "checkout", branch); err != nil {
-				return fmt.Errorf("git checkout %s: %w", branch, err)
-			}
-		}
-	}
-
-	switch strings.ToLower(strategy) {
-	case "rebase", "":
-		if err := runGitCommandStreaming(ctx, "rebase", remoteRef); err != nil {
-			return fmt.Errorf("git rebase %s: %w", remoteRef, err)
+		if picked == nil {
+			return nil
 		}
-	case "merge":
-		if err := runGitCommandStreaming(ctx, "merge", "--no-ff", remoteRef); err != nil {
-			return fmt.Errorf("git merge --no-ff %s: %w", remoteRef, err)
+		if !picked.remote {
+			return reportError(ctx, switchToBranch(ctx, picked.name, "", opts))
 		}
-	default:
-		fmt.Fprintf(ctx.Stderr(), "Usage: %s gitSyncFork [--branch <name>] [--strategy rebase|merge] [--remote <remote>]\n", commandName)
-		return fmt.Errorf("unsupported strategy %q", strategy)
-	}
-
-	action := "Synced"
-	if createdBranch {
-		action = "Created"
-	}
-	fmt.Fprintf(ctx.Stdout(), "✔️ %s %s with %s using %s\n", action, branch, remoteRef, strings.ToLower(strategy))
-	fmt.Fprintf(ctx.Stdout(), "Next: git push origin %s\n", branch)
-	return nil
-}
-
-func runGitCheckout(ctx *snap.Context) error {
-	if ctx.NArgs() > 1 {
-		fmt.Fprintf(ctx.Stderr(), "Usage: %s gitCheckout [branch-or-url]\n", commandName)
-		return fmt.Errorf("expected at most 1 argument, got %d", ctx.NArgs())
-	}
-
-	var (
-		branchInput string
-		err         error
-	)
-
-	if ctx.NArgs() == 1 {
-		branchInput = strings.TrimSpace(ctx.Arg(0))
-	} else {
+		// remote/branch goes through the usual path, which creates the
+		// tracking branch.
+		branchInput = picked.name
+	} else if branchInput == "" {
 		branchInput, err = promptLine(ctx, "Branch name or GitHub tree URL: ")
 		if err != nil {
 			return fmt.Errorf("read branch input: %w", err)
@@ -2075,6 +2484,12 @@ func runGitCheckout(ctx *snap.Context) error {
 		branchDerivedFromURL bool
 	)
 
+	if ref, ok, err := parseGitHubBranchRef(branchInput); err != nil {
+		return reportError(ctx, err)
+	} else if ok {
+		return reportError(ctx, checkoutGitHubBranchRef(ctx, ref, remotes, opts))
+	}
+
 	if strings.HasPrefix(branchInput, "http://") || strings.HasPrefix(branchInput, "https://") {
 		candidates, err := parseGitHubTreeURL(branchInput)
 		if err != nil {
@@ -2121,28 +2536,7 @@ func runGitCheckout(ctx *snap.Context) error {
 		branchName = selected
 	}
 
-	if err := runGitCommandStreaming(ctx, "fetch", remote, branchName); err != nil {
-		return fmt.Errorf("git fetch %s %s: %w", remote, branchName, err)
-	}
-
-	exists, err := gitRefExists(branchName)
-	if err != nil {
-		return fmt.Errorf("check local branch %s: %w", branchName, err)
-	}
-	if exists {
-		return runGitCommandStreaming(ctx, "checkout", branchName)
-	}
-
-	remoteRef := fmt.Sprintf("%s/%s", remote, branchName)
-	remoteExists, err := gitRefExists(remoteRef)
-	if err != nil {
-		return fmt.Errorf("check remote branch %s: %w", remoteRef, err)
-	}
-	if !remoteExists {
-		return fmt.Errorf("remote branch %s not found", remoteRef)
-	}
-
-	return runGitCommandStreaming(ctx, "checkout", "-b", branchName, remoteRef)
+	return reportError(ctx, checkoutRemoteBranch(ctx, remote, branchName, branchName, opts))
 }
 
 func runKillPort(ctx *snap.Context) error {
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/dzonerzy/go-snap/snap"
+)
+
+const prSystemPrompt = "You are an expert software engineer who writes clear GitHub pull request descriptions. Reply with the pull request title on the first line (imperative mood, under 72 characters, no prefix like 'Title:'), then a blank line, then a Markdown body. Unless a template is provided, the body must have the sections '## Summary', '## Changes' (bullet points) and '## Testing'. If a template is provided, fill in its sections instead and drop any checklist items that do not apply. Never include secrets, credentials, or values from .env files, environment variables, or keys—even if they appear in the diff."
+
+var pullRequestTemplatePaths = []string{
+	".github/pull_request_template.md",
+	".github/PULL_REQUEST_TEMPLATE.md",
+	"pull_request_template.md",
+	"PULL_REQUEST_TEMPLATE.md",
+	"docs/pull_request_template.md",
+	"docs/PULL_REQUEST_TEMPLATE.md",
+}
+
+type prOptions struct {
+	base    string
+	remote  string
+	draft   bool
+	offline bool
+}
+
+func runPRCreate(ctx *snap.Context) error {
+	usage := fmt.Sprintf("Usage: %s prCreate [--base <branch>] [--remote <remote>] [--draft] [--offline]", commandName)
+	var opts prOptions
+
+	for i := 0; i < ctx.NArgs(); i++ {
+		arg := strings.TrimSpace(ctx.Arg(i))
+		if arg == "" {
+			continue
+		}
+
+		switch {
+		case arg == "--base":
+			i++
+			if i >= ctx.NArgs() {
+				fmt.Fprintln(ctx.Stderr(), usage)
+				return fmt.Errorf("--base requires a value")
+			}
+			opts.base = strings.TrimSpace(ctx.Arg(i))
+		case strings.HasPrefix(arg, "--base="):
+			opts.base = strings.TrimSpace(strings.TrimPrefix(arg, "--base="))
+		case arg == "--remote":
+			i++
+			if i >= ctx.NArgs() {
+				fmt.Fprintln(ctx.Stderr(), usage)
+				return fmt.Errorf("--remote requires a value")
+			}
+			opts.remote = strings.TrimSpace(ctx.Arg(i))
+		case strings.HasPrefix(arg, "--remote="):
+			opts.remote = strings.TrimSpace(strings.TrimPrefix(arg, "--remote="))
+		case arg == "--draft":
+			opts.draft = true
+		case arg == "--offline":
+			opts.offline = true
+		default:
+			fmt.Fprintln(ctx.Stderr(), usage)
+			return fmt.Errorf("unexpected argument %q", arg)
+		}
+	}
+
+	if err := ensureGitRepository(); err != nil {
+		return reportError(ctx, err)
+	}
+
+	branch, err := currentGitBranch()
+	if err != nil {
+		return reportError(ctx, err)
+	}
+	if branch == "" || branch == "HEAD" {
+		return reportError(ctx, fmt.Errorf("detached HEAD; check out a branch before creating a pull request"))
+	}
+
+	if opts.remote == "" {
+		opts.remote = defaultPullRequestRemote()
+	}
+	exists, remoteURL, err := gitRemoteState(opts.remote)
+	if err != nil {
+		return reportError(ctx, err)
+	}
+	if !exists {
+		return reportError(ctx, fmt.Errorf("git remote %q not found", opts.remote))
+	}
+	// The branch goes wherever commitPush would push it, which for a fork is
+	// origin rather than the repository the pull request is opened against.
+	pushRemote, err := resolvePushRemote(branch, "")
+	if err != nil {
+		return reportError(ctx, err)
+	}
+
+	if opts.base == "" {
+		opts.base = detectBaseBranch(opts.remote)
+	}
+	if opts.base == branch {
+		return reportError(ctx, fmt.Errorf("current branch %s is the base branch; create a feature branch first", branch))
+	}
+
+	baseRef := opts.base
+	if ok, _ := gitRefExists(opts.remote + "/" + opts.base); ok {
+		baseRef = opts.remote + "/" + opts.base
+	}
+
+	commits, err := gitOutput("log", "--reverse", "--format=%s%n%n%b%x1e", baseRef+"..HEAD")
+	if err != nil {
+		return reportError(ctx, err)
+	}
+	if strings.TrimSpace(strings.ReplaceAll(commits, "\x1e", "")) == "" {
+		return reportError(ctx, fmt.Errorf("no commits between %s and %s", baseRef, branch))
+	}
+
+	diff, err := gitOutput("diff", baseRef+"...HEAD")
+	if err != nil {
+		return reportError(ctx, err)
+	}
+
+	template := readPullRequestTemplate()
+
+	message := ""
+	var regenerate func(current, instruction string) (string, error)
+	if !opts.offline {
+		if apiKey, err := resolveOpenAIKey(ctx.Context()); err != nil {
+			fmt.Fprintf(ctx.Stderr(), "%v; drafting the pull request offline instead.\n", err)
+		} else {
+			regenerate = func(current, instruction string) (string, error) {
+				fmt.Fprintf(ctx.Stdout(), "ℹ️ Regenerating with %s...\n", commitModelName)
+				text, err := generatePullRequestText(ctx.Context(), apiKey, branch, baseRef, commits, diff, template, current, instruction)
+				return strings.TrimSpace(trimMatchingQuotes(text)), err
+			}
+			message, err = generatePullRequestText(ctx.Context(), apiKey, branch, baseRef, commits, diff, template, "", "")
+			if errors.Is(err, errGenerationInterrupted) && strings.TrimSpace(message) != "" {
+				fmt.Fprintln(ctx.Stderr(), "Generation interrupted; choose [e] to finish the partial description.")
+			} else if err != nil {
+				fmt.Fprintf(ctx.Stderr(), "%v; drafting the pull request offline instead.\n", err)
+				message = ""
+			}
+		}
+	}
+	if message == "" {
+		message = offlinePullRequestText(branch, commits, template)
+	}
+
+	message, confirmed, err := reviewGeneratedText(ctx, textReview{
+		noun:        "pull request (first line is the title)",
+		acceptLabel: "create",
+		editLabel:   "edit",
+		regenerate:  regenerate,
+		showDiff: func() {
+			if err := runGitCommandStreaming(ctx, "diff", "--stat", baseRef+"...HEAD"); err != nil {
+				fmt.Fprintf(ctx.Stderr(), "git diff --stat %s...HEAD: %v\n", baseRef, err)
+			}
+		},
+	}, []string{strings.TrimSpace(trimMatchingQuotes(message))}, 0)
+	if err != nil {
+		return reportError(ctx, err)
+	}
+	if !confirmed {
+		fmt.Fprintln(ctx.Stdout(), "Pull request cancelled.")
+		return nil
+	}
+
+	title, body := splitPullRequestText(message)
+	if title == "" {
+		return reportError(ctx, fmt.Errorf("pull request title is empty"))
+	}
+
+	if err := ensureBranchPushed(ctx, pushRemote); err != nil {
+		return reportError(ctx, err)
+	}
+	head, err := pullRequestHeadRef(branch, pushRemote, remoteURL)
+	if err != nil {
+		return reportError(ctx, err)
+	}
+
+	prURL, err := createPullRequest(ctx, remoteURL, opts, head, title, body)
+	if err != nil {
+		return reportError(ctx, err)
+	}
+
+	fmt.Fprintf(ctx.Stdout(), "✔️ Opened pull request %s\n", prURL)
+	return nil
+}
+
+// defaultPullRequestRemote is the repository pull requests are opened
+// against: upstream in a fork, except a private fork, which only has origin
+// to open them on.
+func defaultPullRequestRemote() string {
+	if exists, _, err := gitRemoteState("upstream"); err == nil && exists && !isPrivateForkRepo() {
+		return "upstream"
+	}
+	return "origin"
+}
+
+// pullRequestHeadRef names the pushed branch for the pull request: the bare
+// branch when it lives in the base repository, owner:branch for a fork.
+func pullRequestHeadRef(branch, pushRemote, baseURL string) (string, error) {
+	_, pushURL, err := gitRemoteState(pushRemote)
+	if err != nil {
+		return "", err
+	}
+	if urlsEquivalent(pushURL, baseURL) {
+		return branch, nil
+	}
+	host, repoPath, ok := extractRemoteHostPath(pushURL)
+	if !ok || host != "github.com" {
+		return "", fmt.Errorf("remote %s (%s) is not a GitHub repository", pushRemote, pushURL)
+	}
+	owner, _, _ := strings.Cut(repoPath, "/")
+	return owner + ":" + branch, nil
+}
+
+func detectBaseBranch(remote string) string {
+	out, err := exec.Command("git", "symbolic-ref", "--short", "refs/remotes/"+remote+"/HEAD").Output()
+	if err == nil {
+		trimmed := strings.TrimSpace(string(out))
+		if trimmed != "" {
+			return strings.TrimPrefix(trimmed, remote+"/")
+		}
+	}
+
+	for _, candidate := range []string{"main", "master"} {
+		if ok, _ := gitRefExists(remote + "/" + candidate); ok {
+			return candidate
+		}
+		if ok, _ := gitRefExists("refs/heads/" + candidate); ok {
+			return candidate
+		}
+	}
+
+	return "main"
+}
+
+func readPullRequestTemplate() string {
+	root, err := gitOutput("rev-parse", "--show-toplevel")
+	if err != nil {
+		return ""
+	}
+	root = strings.TrimSpace(root)
+
+	for _, candidate := range pullRequestTemplatePaths {
+		content, err := os.ReadFile(filepath.Join(root, candidate))
+		if err == nil && strings.TrimSpace(string(content)) != "" {
+			return string(content)
+		}
+	}
+	return ""
+}
+
+// generatePullRequestText drafts the title and body. With previous set it
+// revises that draft, following instruction when there is one.
+func generatePullRequestText(parent context.Context, apiKey, branch, baseRef, commits, diff, template, previous, instruction string) (string, error) {
+	trimmedDiff, truncated := truncateDiffForCommit(diff)
+
+	var userPrompt strings.Builder
+	fmt.Fprintf(&userPrompt, "Write a pull request title and description for merging branch %s into %s.\n\nCommits:\n", branch, baseRef)
+	userPrompt.WriteString(strings.ReplaceAll(commits, "\x1e", ""))
+	userPrompt.WriteString("\n\nGit diff:\n")
+	userPrompt.WriteString(trimmedDiff)
+	if truncated {
+		userPrompt.WriteString("\n\n[Diff truncated to fit within prompt]")
+	}
+	if template != "" {
+		userPrompt.WriteString("\n\nPull request template to fill in:\n")
+		userPrompt.WriteString(template)
+	}
+	if previous != "" {
+		userPrompt.WriteString("\n\nPrevious draft:\n")
+		userPrompt.WriteString(previous)
+		if trimmed := strings.TrimSpace(instruction); trimmed != "" {
+			userPrompt.WriteString("\n\nRevise the previous draft following this instruction: ")
+			userPrompt.WriteString(trimmed)
+		} else {
+			userPrompt.WriteString("\n\nWrite a different, improved title and description for the same changes.")
+		}
+	}
+
+	text, err := streamChatCompletion(parent, apiKey, prSystemPrompt, userPrompt.String(), streamPreview, nil)
+	if errors.Is(err, errGenerationInterrupted) {
+		return text, err
+	}
+	if err != nil {
+		return "", fmt.Errorf("generate pull request description: %w", err)
+	}
+	return text, nil
+}
+
+func offlinePullRequestText(branch, commits, template string) string {
+	var subjects []string
+	for _, record := range strings.Split(commits, "\x1e") {
+		subject, _, _ := strings.Cut(strings.TrimSpace(record), "\n")
+		if subject = strings.TrimSpace(subject); subject != "" {
+			subjects = append(subjects, subject)
+		}
+	}
+
+	title := branch
+	if len(subjects) == 1 {
+		title = subjects[0]
+	} else if idx := strings.LastIndex(branch, "/"); idx >= 0 {
+		title = strings.ReplaceAll(branch[idx+1:], "-", " ")
+	}
+
+	var body strings.Builder
+	if template != "" {
+		body.WriteString(strings.TrimSpace(template))
+		body.WriteString("\n\n## Commits\n\n")
+	} else {
+		fmt.Fprintf(&body, "## Summary\n\nChanges from branch `%s`.\n\n## Changes\n\n", branch)
+	}
+	for _, subject := range subjects {
+		fmt.Fprintf(&body, "- %s\n", subject)
+	}
+	if template == "" {
+		body.WriteString("\n## Testing\n\n")
+	}
+
+	return title + "\n\n" + body.String()
+}
+
+func splitPullRequestText(message string) (string, string) {
+	title, body, _ := strings.Cut(strings.TrimSpace(message), "\n")
+	title = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(title), "#"))
+	return strings.TrimSpace(title), strings.TrimSpace(body)
+}
+
+func ensureBranchPushed(ctx *snap.Context, remote string) error {
+	if upstream, err := gitOutput("rev-parse", "--abbrev-ref", "--symbolic-full-name", "@{u}"); err == nil && strings.TrimSpace(upstream) != "" {
+		ahead, err := gitOutput("rev-list", "--count", "@{u}..HEAD")
+		if err == nil && strings.TrimSpace(ahead) == "0" {
+			return nil
+		}
+	}
+
+	return pushCurrentBranch(ctx, pushOptions{remote: remote})
+}
+
+// createPullRequest opens a pull request on the repository at remoteURL;
+// head is a branch there or owner:branch on a fork.
+func createPullRequest(ctx *snap.Context, remoteURL string, opts prOptions, head, title, body string) (string, error) {
+	host, repoPath, ok := extractRemoteHostPath(remoteURL)
+	if !ok || host != "github.com" || strings.Count(repoPath, "/") != 1 {
+		return "", fmt.Errorf("remote %s (%s) is not a GitHub repository", opts.remote, remoteURL)
+	}
+
+	respBody, err := githubAPI(ctx.Context(), http.MethodPost, "repos/"+repoPath+"/pulls", map[string]any{
+		"title": title,
+		"body":  body,
+		"head":  head,
+		"base":  opts.base,
+		"draft": opts.draft,
+	})
+	if err != nil {
+		return "", fmt.Errorf("create pull request: %w", err)
+	}
+
+	var created struct {
+		HTMLURL string `json:"html_url"`
+	}
+	if err := json.Unmarshal(respBody, &created); err != nil {
+		return "", fmt.Errorf("decode GitHub response: %w", err)
+	}
+	if created.HTMLURL == "" {
+		return "", fmt.Errorf("GitHub response did not include a pull request URL")
+	}
+	return created.HTMLURL, nil
+}
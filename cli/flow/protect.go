@@ -0,0 +1,274 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/dzonerzy/go-snap/snap"
+)
+
+const (
+	protectedRemoteKey  = "flow.protectedRemote"
+	allowProtectedEnv   = "FLOW_ALLOW_PROTECTED_PUSH"
+	prePushHookMarker   = "# installed by fgo protect"
+	chainedPrePushHook  = "pre-push.chained"
+	prePushHookTemplate = `#!/bin/sh
+%s
+# Blocks pushes to the URLs listed in git config %s.
+# Set %s=1 to push anyway.
+
+fgo=%s
+if [ ! -x "$fgo" ]; then
+	fgo=$(command -v %s)
+fi
+
+if [ -z "$%s" ]; then
+	if [ -z "$fgo" ]; then
+		echo "pre-push: %s not found; set %s=1 to push without the protection check" >&2
+		exit 1
+	fi
+	"$fgo" protect --check "$1" "$2" || exit 1
+fi
+
+chained="$(dirname "$0")/%s"
+if [ -x "$chained" ]; then
+	exec "$chained" "$@"
+fi
+exit 0
+`
+)
+
+func runProtect(ctx *snap.Context) error {
+	usage := fmt.Sprintf("Usage: %s protect [<remote|url>...] [--list] [--remove <remote|url>]", commandName)
+
+	var (
+		targets []string
+		removes []string
+		list    bool
+		check   []string
+	)
+	for i := 0; i < ctx.NArgs(); i++ {
+		arg := strings.TrimSpace(ctx.Arg(i))
+		if arg == "" {
+			continue
+		}
+		switch {
+		case arg == "--list":
+			list = true
+		case arg == "--remove":
+			i++
+			if i >= ctx.NArgs() {
+				fmt.Fprintln(ctx.Stderr(), usage)
+				return fmt.Errorf("--remove requires a value")
+			}
+			removes = append(removes, strings.TrimSpace(ctx.Arg(i)))
+		case arg == "--check":
+			for i++; i < ctx.NArgs(); i++ {
+				check = append(check, ctx.Arg(i))
+			}
+			if len(check) != 2 {
+				return fmt.Errorf("--check expects <remote> <url>")
+			}
+		case strings.HasPrefix(arg, "--"):
+			fmt.Fprintln(ctx.Stderr(), usage)
+			return fmt.Errorf("unknown flag %q", arg)
+		default:
+			targets = append(targets, arg)
+		}
+	}
+
+	if err := ensureGitRepository(); err != nil {
+		return reportError(ctx, err)
+	}
+
+	if check != nil {
+		return checkProtectedPush(ctx, check[0], check[1])
+	}
+
+	for _, target := range removes {
+		if err := unprotectRemote("", target); err != nil {
+			return reportError(ctx, err)
+		}
+		fmt.Fprintf(ctx.Stdout(), "✔️ %s is no longer protected\n", target)
+	}
+
+	if len(targets) == 0 && len(removes) == 0 && !list {
+		if exists, _, err := gitRemoteState("upstream"); err == nil && exists {
+			targets = []string{"upstream"}
+		} else {
+			fmt.Fprintln(ctx.Stderr(), usage)
+			return fmt.Errorf("no upstream remote; name the remote or URL to protect")
+		}
+	}
+
+	for _, target := range targets {
+		url, err := protectRemote("", target)
+		if err != nil {
+			return reportError(ctx, err)
+		}
+		fmt.Fprintf(ctx.Stdout(), "✔️ Pushes to %s are blocked\n", url)
+	}
+	if len(targets) > 0 {
+		if err := installPrePushHook(""); err != nil {
+			return reportError(ctx, err)
+		}
+	}
+
+	if list || len(targets) > 0 {
+		urls := protectedRemoteURLs("")
+		if len(urls) == 0 {
+			fmt.Fprintln(ctx.Stdout(), "ℹ️ No protected remotes")
+			return nil
+		}
+		fmt.Fprintln(ctx.Stdout(), "Protected:")
+		for _, url := range urls {
+			fmt.Fprintf(ctx.Stdout(), "  %s\n", url)
+		}
+	}
+	return nil
+}
+
+// checkProtectedPush is run by the pre-push hook with the remote name and URL
+// git passes to it.
+func checkProtectedPush(ctx *snap.Context, remote, url string) error {
+	if _, ok := lookupNonEmptyEnv(allowProtectedEnv); ok {
+		return nil
+	}
+	for _, protected := range protectedRemoteURLs("") {
+		if urlsEquivalent(protected, url) {
+			fmt.Fprintf(ctx.Stderr(), "⚠️ Refusing to push to %s (%s): it is protected by %s protect.\n", remote, url, commandName)
+			fmt.Fprintf(ctx.Stderr(), "Push to origin instead, or set %s=1 to push anyway.\n", allowProtectedEnv)
+			return fmt.Errorf("push to protected remote %s blocked", remote)
+		}
+	}
+	return nil
+}
+
+// protectRemote records target, a remote name or URL, as protected in the
+// repository at dir and returns the URL that was stored.
+func protectRemote(dir, target string) (string, error) {
+	url := resolveProtectTarget(dir, target)
+	for _, existing := range protectedRemoteURLs(dir) {
+		if urlsEquivalent(existing, url) {
+			return url, nil
+		}
+	}
+	if out, err := gitInDir(dir, "config", "--add", protectedRemoteKey, url).CombinedOutput(); err != nil {
+		return "", fmt.Errorf("git config --add %s: %s", protectedRemoteKey, strings.TrimSpace(string(out)))
+	}
+	return url, nil
+}
+
+func unprotectRemote(dir, target string) error {
+	url := resolveProtectTarget(dir, target)
+	urls := protectedRemoteURLs(dir)
+	kept := urls[:0]
+	found := false
+	for _, existing := range urls {
+		if urlsEquivalent(existing, url) {
+			found = true
+			continue
+		}
+		kept = append(kept, existing)
+	}
+	if !found {
+		return fmt.Errorf("%s is not protected", target)
+	}
+
+	if out, err := gitInDir(dir, "config", "--unset-all", protectedRemoteKey).CombinedOutput(); err != nil {
+		return fmt.Errorf("git config --unset-all %s: %s", protectedRemoteKey, strings.TrimSpace(string(out)))
+	}
+	for _, existing := range kept {
+		if out, err := gitInDir(dir, "config", "--add", protectedRemoteKey, existing).CombinedOutput(); err != nil {
+			return fmt.Errorf("git config --add %s: %s", protectedRemoteKey, strings.TrimSpace(string(out)))
+		}
+	}
+	return nil
+}
+
+func resolveProtectTarget(dir, target string) string {
+	if out, err := gitInDir(dir, "remote", "get-url", "--all", target).Output(); err == nil {
+		if url := strings.TrimSpace(strings.SplitN(string(out), "\n", 2)[0]); url != "" {
+			return url
+		}
+	}
+	return target
+}
+
+func protectedRemoteURLs(dir string) []string {
+	out, err := gitInDir(dir, "config", "--get-all", protectedRemoteKey).Output()
+	if err != nil {
+		return nil
+	}
+	var urls []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			urls = append(urls, line)
+		}
+	}
+	return urls
+}
+
+// installPrePushHook writes the protection hook into the repository at dir.
+// An existing pre-push hook is kept as pre-push.chained and run afterwards.
+func installPrePushHook(dir string) error {
+	hooksDir, err := gitHooksDir(dir)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(hooksDir, 0o755); err != nil {
+		return fmt.Errorf("create directory %s: %w", hooksDir, err)
+	}
+
+	hookPath := filepath.Join(hooksDir, "pre-push")
+	existing, err := os.ReadFile(hookPath)
+	switch {
+	case err == nil && !strings.Contains(string(existing), prePushHookMarker):
+		chainedPath := filepath.Join(hooksDir, chainedPrePushHook)
+		if _, err := os.Stat(chainedPath); err == nil {
+			return fmt.Errorf("both %s and %s exist; merge them by hand", hookPath, chainedPath)
+		}
+		if err := os.Rename(hookPath, chainedPath); err != nil {
+			return fmt.Errorf("rename %s: %w", hookPath, err)
+		}
+	case err != nil && !errors.Is(err, os.ErrNotExist):
+		return fmt.Errorf("read %s: %w", hookPath, err)
+	}
+
+	script := fmt.Sprintf(prePushHookTemplate,
+		prePushHookMarker, protectedRemoteKey, allowProtectedEnv,
+		shellQuote(fgoExecutablePath()), commandName,
+		allowProtectedEnv, commandName, allowProtectedEnv,
+		chainedPrePushHook)
+	if err := os.WriteFile(hookPath, []byte(script), 0o755); err != nil {
+		return fmt.Errorf("write %s: %w", hookPath, err)
+	}
+	return os.Chmod(hookPath, 0o755)
+}
+
+func fgoExecutablePath() string {
+	if path, err := exec.LookPath(commandName); err == nil {
+		if abs, err := filepath.Abs(path); err == nil {
+			return abs
+		}
+	}
+	if path, err := os.Executable(); err == nil {
+		return path
+	}
+	return commandName
+}
+
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+func gitInDir(dir string, args ...string) *exec.Cmd {
+	if dir != "" {
+		args = append([]string{"-C", dir}, args...)
+	}
+	return exec.Command("git", args...)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"path"
+	"strings"
+
+	"github.com/dzonerzy/go-snap/snap"
+)
+
+type pushOptions struct {
+	remote         string
+	forceWithLease bool
+}
+
+// pushCurrentBranch pushes HEAD's branch, setting the upstream on the first
+// push and offering a pull --rebase when the remote rejects the push.
+func pushCurrentBranch(ctx *snap.Context, opts pushOptions) error {
+	branch, err := currentGitBranch()
+	if err != nil {
+		return err
+	}
+	if branch == "HEAD" {
+		return fmt.Errorf("HEAD is detached; check out a branch before pushing")
+	}
+
+	remote, err := resolvePushRemote(branch, opts.remote)
+	if err != nil {
+		return err
+	}
+
+	upstreamRemote := gitConfigValue("branch." + branch + ".remote")
+	setUpstream := upstreamRemote == "" || upstreamRemote == "."
+	if !setUpstream && upstreamRemote != remote {
+		fmt.Fprintf(ctx.Stdout(), "ℹ️ %s tracks %s; pushing to %s without changing the upstream\n", branch, upstreamRemote, remote)
+	}
+
+	args := []string{"push"}
+	if opts.forceWithLease {
+		args = append(args, "--force-with-lease")
+	}
+	if setUpstream {
+		args = append(args, "--set-upstream")
+	}
+	args = append(args, remote, branch)
+
+	for attempt := 0; ; attempt++ {
+		output, err := runGitPushCapturing(ctx, args)
+		if err == nil {
+			return nil
+		}
+		if attempt > 0 || opts.forceWithLease || !pushWasRejected(output) {
+			return fmt.Errorf("git %s: %w", strings.Join(args, " "), err)
+		}
+
+		fmt.Fprintf(ctx.Stdout(), "%s/%s has commits you don't have locally.\n", remote, branch)
+		fmt.Fprintf(ctx.Stdout(), "Run git pull --rebase %s %s and push again? [y/n]: ", remote, branch)
+		choice, readErr := readConfirmationChoice(ctx)
+		fmt.Fprintln(ctx.Stdout())
+		if readErr != nil {
+			return fmt.Errorf("reading choice: %w", readErr)
+		}
+		if strings.ToLower(string(choice)) != "y" {
+			return fmt.Errorf("push to %s rejected; pull and push again, or rerun with --force-with-lease", remote)
+		}
+
+		if err := runGitCommandStreaming(ctx, "pull", "--rebase", remote, branch); err != nil {
+			fmt.Fprintln(ctx.Stderr(), "Rebase stopped; resolve it with git rebase --continue or git rebase --abort, then push again.")
+			return fmt.Errorf("git pull --rebase %s %s: %w", remote, branch, err)
+		}
+	}
+}
+
+// checkPushTarget validates the push remote before anything is committed.
+func checkPushTarget(opts pushOptions) error {
+	branch, err := currentGitBranch()
+	if err != nil {
+		return err
+	}
+	_, err = resolvePushRemote(branch, opts.remote)
+	return err
+}
+
+// resolvePushRemote picks the remote to push branch to. Private forks created
+// by privateForkRepo always push to origin so nothing reaches upstream.
+func resolvePushRemote(branch, requested string) (string, error) {
+	if isPrivateForkRepo() {
+		if requested != "" && requested != "origin" {
+			return "", fmt.Errorf("refusing to push to %s: this is a private fork, push to origin instead", requested)
+		}
+		return "origin", nil
+	}
+
+	if requested != "" {
+		if exists, _, err := gitRemoteState(requested); err != nil {
+			return "", err
+		} else if !exists {
+			return "", fmt.Errorf("remote %s does not exist", requested)
+		}
+		return requested, nil
+	}
+
+	for _, key := range []string{"branch." + branch + ".pushRemote", "remote.pushDefault", "branch." + branch + ".remote"} {
+		if value := gitConfigValue(key); value != "" && value != "." {
+			return value, nil
+		}
+	}
+
+	remotes, err := listGitRemotes()
+	if err != nil {
+		return "", err
+	}
+	for _, name := range remotes {
+		if name == "origin" {
+			return name, nil
+		}
+	}
+	if len(remotes) == 1 {
+		return remotes[0], nil
+	}
+	if len(remotes) == 0 {
+		return "", fmt.Errorf("no git remotes configured")
+	}
+	return "", fmt.Errorf("several remotes configured (%s); choose one with --remote", strings.Join(remotes, ", "))
+}
+
+// isPrivateForkRepo reports whether the repository has the privateForkRepo
+// layout: an upstream remote plus an origin whose repository name ends in -i.
+func isPrivateForkRepo() bool {
+	upstreamExists, _, err := gitRemoteState("upstream")
+	if err != nil || !upstreamExists {
+		return false
+	}
+	originExists, originURL, err := gitRemoteState("origin")
+	if err != nil || !originExists {
+		return false
+	}
+	_, repoPath, _ := extractRemoteHostPath(originURL)
+	return strings.HasSuffix(path.Base(repoPath), "-i")
+}
+
+func runGitPushCapturing(ctx *snap.Context, args []string) (string, error) {
+	var output bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Stdout = ctx.Stdout()
+	cmd.Stderr = io.MultiWriter(ctx.Stderr(), &output)
+	cmd.Stdin = ctx.Stdin()
+	err := cmd.Run()
+	return output.String(), err
+}
+
+func pushWasRejected(output string) bool {
+	return strings.Contains(output, "[rejected]") &&
+		(strings.Contains(output, "non-fast-forward") || strings.Contains(output, "fetch first"))
+}
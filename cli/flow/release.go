@@ -0,0 +1,248 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/dzonerzy/go-snap/snap"
+)
+
+var semverTagPattern = regexp.MustCompile(`^(v?)(\d+)\.(\d+)\.(\d+)$`)
+
+type semverTag struct {
+	prefix              string
+	major, minor, patch int
+}
+
+func (v semverTag) String() string {
+	return fmt.Sprintf("%s%d.%d.%d", v.prefix, v.major, v.minor, v.patch)
+}
+
+func (v semverTag) bump(part string) semverTag {
+	switch part {
+	case "major":
+		return semverTag{prefix: v.prefix, major: v.major + 1}
+	case "minor":
+		return semverTag{prefix: v.prefix, major: v.major, minor: v.minor + 1}
+	default:
+		return semverTag{prefix: v.prefix, major: v.major, minor: v.minor, patch: v.patch + 1}
+	}
+}
+
+func runRelease(ctx *snap.Context) error {
+	usage := fmt.Sprintf("Usage: %s release <major|minor|patch> [--remote <name>] [--no-changelog] [--offline] [--dry-run] [--yes]", commandName)
+
+	var (
+		part        string
+		remote      string
+		noChangelog bool
+		offline     bool
+		dryRun      bool
+		assumeYes   bool
+	)
+	for i := 0; i < ctx.NArgs(); i++ {
+		arg := strings.TrimSpace(ctx.Arg(i))
+		if arg == "" {
+			continue
+		}
+
+		switch {
+		case arg == "major" || arg == "minor" || arg == "patch":
+			if part != "" {
+				fmt.Fprintln(ctx.Stderr(), usage)
+				return fmt.Errorf("unexpected argument %q", arg)
+			}
+			part = arg
+		case arg == "--no-changelog":
+			noChangelog = true
+		case arg == "--offline":
+			offline = true
+		case arg == "--dry-run":
+			dryRun = true
+		case arg == "--yes" || arg == "-y":
+			assumeYes = true
+		case arg == "--remote":
+			i++
+			if i >= ctx.NArgs() || strings.TrimSpace(ctx.Arg(i)) == "" {
+				fmt.Fprintln(ctx.Stderr(), usage)
+				return fmt.Errorf("--remote requires a value")
+			}
+			remote = strings.TrimSpace(ctx.Arg(i))
+		case strings.HasPrefix(arg, "--remote="):
+			remote = strings.TrimSpace(strings.TrimPrefix(arg, "--remote="))
+		default:
+			fmt.Fprintln(ctx.Stderr(), usage)
+			return fmt.Errorf("unexpected argument %q", arg)
+		}
+	}
+	if part == "" {
+		fmt.Fprintln(ctx.Stderr(), usage)
+		return fmt.Errorf("choose major, minor or patch")
+	}
+
+	if err := ensureGitRepository(); err != nil {
+		return reportError(ctx, err)
+	}
+
+	status, err := gitOutput("status", "--porcelain")
+	if err != nil {
+		return reportError(ctx, err)
+	}
+	if strings.TrimSpace(status) != "" {
+		return reportError(ctx, fmt.Errorf("working tree has uncommitted changes; commit or stash them before releasing"))
+	}
+
+	branch, err := currentGitBranch()
+	if err != nil {
+		return reportError(ctx, err)
+	}
+	if branch == "HEAD" {
+		return reportError(ctx, fmt.Errorf("HEAD is detached; check out the branch to release from"))
+	}
+	remote, err = resolvePushRemote(branch, remote)
+	if err != nil {
+		return reportError(ctx, err)
+	}
+
+	previous, found, err := latestSemverTag()
+	if err != nil {
+		return reportError(ctx, err)
+	}
+	if !found {
+		previous = semverTag{prefix: "v"}
+	}
+	next := previous.bump(part)
+
+	opts := changelogOptions{version: next.String(), offline: offline}
+	if found {
+		opts.from = previous.String()
+		count, err := gitOutput("rev-list", "--count", previous.String()+"..HEAD")
+		if err != nil {
+			return reportError(ctx, err)
+		}
+		if strings.TrimSpace(count) == "0" {
+			return reportError(ctx, fmt.Errorf("no commits since %s; nothing to release", previous))
+		}
+	}
+	if exists, err := gitRefExists("refs/tags/" + next.String()); err != nil {
+		return reportError(ctx, fmt.Errorf("check tag %s: %w", next, err))
+	} else if exists {
+		return reportError(ctx, fmt.Errorf("tag %s already exists", next))
+	}
+
+	notes, err := buildChangelog(ctx, opts)
+	if err != nil {
+		return reportError(ctx, err)
+	}
+	markdown := renderChangelogMarkdown(notes)
+
+	changelogFile, err := changelogPath("")
+	if err != nil {
+		return reportError(ctx, err)
+	}
+	updateChangelog := !noChangelog
+	if _, err := os.Stat(changelogFile); err != nil {
+		updateChangelog = false
+	}
+
+	if found {
+		fmt.Fprintf(ctx.Stdout(), "Releasing %s (previous %s) from %s to %s\n\n", next, previous, branch, remote)
+	} else {
+		fmt.Fprintf(ctx.Stdout(), "Releasing %s (first release) from %s to %s\n\n", next, branch, remote)
+	}
+	fmt.Fprintln(ctx.Stdout(), markdown)
+	if updateChangelog {
+		fmt.Fprintf(ctx.Stdout(), "ℹ️ %s will be updated and committed\n", changelogFileName)
+	}
+
+	if dryRun {
+		fmt.Fprintln(ctx.Stdout(), "Dry run; nothing was tagged or pushed.")
+		return nil
+	}
+
+	if !assumeYes {
+		fmt.Fprintf(ctx.Stdout(), "Tag %s and push it to %s? [y/n]: ", next, remote)
+		choice, err := readConfirmationChoice(ctx)
+		fmt.Fprintln(ctx.Stdout())
+		if err != nil {
+			return reportError(ctx, fmt.Errorf("reading choice: %w", err))
+		}
+		if strings.ToLower(string(choice)) != "y" {
+			fmt.Fprintln(ctx.Stdout(), "Release cancelled.")
+			return nil
+		}
+	}
+
+	if updateChangelog {
+		if err := writeChangelogSection(changelogFile, notes); err != nil {
+			return reportError(ctx, err)
+		}
+		if err := runGitCommandStreaming(ctx, "add", "--", changelogFile); err != nil {
+			return reportError(ctx, fmt.Errorf("git add %s: %w", changelogFileName, err))
+		}
+		if err := runGitCommandStreaming(ctx, "commit", "-m", "Release "+next.String()); err != nil {
+			return reportError(ctx, fmt.Errorf("git commit: %w", err))
+		}
+	}
+
+	tagCmd := exec.Command("git", "tag", "-a", next.String(), "-F", "-")
+	tagCmd.Stdin = strings.NewReader("Release " + next.String() + "\n\n" + markdown)
+	tagCmd.Stderr = ctx.Stderr()
+	if err := tagCmd.Run(); err != nil {
+		return reportError(ctx, fmt.Errorf("git tag %s: %w", next, err))
+	}
+	fmt.Fprintf(ctx.Stdout(), "✔️ Tagged %s\n", next)
+
+	if updateChangelog {
+		if err := pushCurrentBranch(ctx, pushOptions{remote: remote}); err != nil {
+			return reportError(ctx, err)
+		}
+	}
+	if err := runGitCommandStreaming(ctx, "push", remote, "refs/tags/"+next.String()); err != nil {
+		return reportError(ctx, fmt.Errorf("git push %s %s: %w", remote, next, err))
+	}
+
+	fmt.Fprintf(ctx.Stdout(), "✔️ Released %s\n", next)
+	return nil
+}
+
+// latestSemverTag returns the highest vX.Y.Z tag reachable from HEAD.
+func latestSemverTag() (semverTag, bool, error) {
+	out, err := gitOutput("tag", "--merged", "HEAD", "--list")
+	if err != nil {
+		return semverTag{}, false, err
+	}
+
+	var (
+		best  semverTag
+		found bool
+	)
+	for _, line := range strings.Split(out, "\n") {
+		m := semverTagPattern.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil {
+			continue
+		}
+		major, _ := strconv.Atoi(m[2])
+		minor, _ := strconv.Atoi(m[3])
+		patch, _ := strconv.Atoi(m[4])
+		tag := semverTag{prefix: m[1], major: major, minor: minor, patch: patch}
+		if !found || semverLess(best, tag) {
+			best, found = tag, true
+		}
+	}
+	return best, found, nil
+}
+
+func semverLess(a, b semverTag) bool {
+	if a.major != b.major {
+		return a.major < b.major
+	}
+	if a.minor != b.minor {
+		return a.minor < b.minor
+	}
+	return a.patch < b.patch
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dzonerzy/go-snap/snap"
+)
+
+const (
+	// reviewPromptVersion is part of the review cache key, like
+	// commitPromptVersion for commit messages.
+	reviewPromptVersion = "1"
+	reviewContextLines  = 3
+	reviewSystemPrompt  = "You are a meticulous senior engineer reviewing a staged git diff before it is committed. Report only real problems introduced by the change: bugs, crashes, security issues, data loss, race conditions, broken error handling, and clear mistakes. Skip style nits and praise. Never repeat secrets, credentials, or values from .env files even if they appear in the diff. Respond with JSON only, in the form {\"findings\":[{\"file\":\"path/in/repo\",\"line\":42,\"severity\":\"high|medium|low\",\"message\":\"...\"}]}, where line is the line number in the new version of the file. Return {\"findings\":[]} when there is nothing worth flagging."
+)
+
+var hunkHeaderPattern = regexp.MustCompile(`^@@ -\d+(?:,\d+)? \+(\d+)(?:,(\d+))? @@`)
+
+type reviewFinding struct {
+	File     string     `json:"file"`
+	Line     reviewLine `json:"line"`
+	Severity string     `json:"severity"`
+	Message  string     `json:"message"`
+}
+
+// reviewLine accepts line numbers the model returns as numbers or strings.
+type reviewLine int
+
+func (l *reviewLine) UnmarshalJSON(data []byte) error {
+	raw := strings.Trim(strings.TrimSpace(string(data)), `"`)
+	if raw == "" || raw == "null" {
+		*l = 0
+		return nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil {
+		*l = 0
+		return nil
+	}
+	*l = reviewLine(n)
+	return nil
+}
+
+type reviewCacheEntry struct {
+	Created  time.Time       `json:"created"`
+	Model    string          `json:"model"`
+	Findings []reviewFinding `json:"findings"`
+}
+
+// reviewStagedChanges stages everything, asks the model to review the staged
+// diff and lets the user decide whether to continue. It returns false when
+// the user aborts.
+func reviewStagedChanges(ctx *snap.Context, opts commitOptions) (bool, error) {
+	if opts.offline {
+		fmt.Fprintln(ctx.Stdout(), "ℹ️ Skipping review in offline mode")
+		return true, nil
+	}
+	apiKey, err := resolveOpenAIKey(ctx.Context())
+	if err != nil {
+		fmt.Fprintf(ctx.Stdout(), "ℹ️ %v; skipping review.\n", err)
+		return true, nil
+	}
+
+	for {
+		if err := runGitCommandStreaming(ctx, "add", "."); err != nil {
+			return false, fmt.Errorf("git add .: %w", err)
+		}
+		diffOutput, err := exec.Command("git", "diff", "--cached", "--no-color", "--no-ext-diff").Output()
+		if err != nil {
+			return false, fmt.Errorf("git diff --cached: %w", err)
+		}
+		diff := string(diffOutput)
+		if strings.TrimSpace(diff) == "" {
+			return true, nil
+		}
+
+		findings, err := reviewDiff(ctx, apiKey, diff, opts.noCache)
+		if err != nil {
+			fmt.Fprintf(ctx.Stderr(), "⚠️ Review failed (%v); continuing without it.\n", err)
+			return true, nil
+		}
+		if len(findings) == 0 {
+			fmt.Fprintln(ctx.Stdout(), "✔️ Review found no issues")
+			return true, nil
+		}
+
+		printReviewFindings(ctx, findings, parseStagedDiff(diff))
+
+		reopened := false
+		for !reopened {
+			fmt.Fprintln(ctx.Stdout(), "Options: [c] continue  [a] abort  [o] open a finding in the editor")
+			fmt.Fprint(ctx.Stdout(), "Choice [c/a/o]: ")
+			choice, err := readConfirmationChoice(ctx)
+			fmt.Fprintln(ctx.Stdout())
+			if err != nil {
+				return false, fmt.Errorf("reading choice: %w", err)
+			}
+
+			switch strings.ToLower(string(choice)) {
+			case "c":
+				return true, nil
+			case "a", "q":
+				return false, nil
+			case "o":
+				finding := findings[0]
+				if len(findings) > 1 {
+					raw, err := promptLine(ctx, fmt.Sprintf("Finding to open [1-%d]: ", len(findings)))
+					if err != nil {
+						return false, err
+					}
+					n, err := strconv.Atoi(strings.TrimSpace(raw))
+					if err != nil || n < 1 || n > len(findings) {
+						fmt.Fprintln(ctx.Stdout(), "Invalid finding number.")
+						continue
+					}
+					finding = findings[n-1]
+				}
+				if err := openFileAtLine(ctx, finding.File, int(finding.Line)); err != nil {
+					fmt.Fprintf(ctx.Stderr(), "⚠️ %v\n", err)
+					continue
+				}
+				reopened = true
+			default:
+				fmt.Fprintln(ctx.Stdout(), "Please choose c, a, or o.")
+			}
+		}
+		fmt.Fprintln(ctx.Stdout(), "ℹ️ Reviewing the updated changes...")
+	}
+}
+
+func reviewDiff(ctx *snap.Context, apiKey, diff string, noCache bool) ([]reviewFinding, error) {
+	key := reviewCache.key(diff)
+	if !noCache {
+		if entry, err := loadReviewCache(key); err == nil && entry != nil {
+			fmt.Fprintf(ctx.Stdout(), "ℹ️ Using cached review from %s (pass --no-cache to review again)\n", entry.Created.Local().Format("Jan 2 15:04"))
+			return entry.Findings, nil
+		}
+	}
+
+	trimmed, truncated := truncateDiffForCommit(diff)
+	var prompt strings.Builder
+	prompt.WriteString("Review this staged diff.\n\n")
+	prompt.WriteString(trimmed)
+	if truncated {
+		prompt.WriteString("\n\n[Diff truncated; review only what is shown.]")
+	}
+
+	fmt.Fprintf(ctx.Stdout(), "ℹ️ Asking %s to review the staged changes...\n", commitModelName)
+	response, err := requestChatCompletion(ctx.Context(), apiKey, reviewSystemPrompt, prompt.String())
+	if err != nil {
+		return nil, err
+	}
+
+	findings, err := parseReviewFindings(response)
+	if err != nil {
+		return nil, err
+	}
+	_ = saveReviewCache(key, findings)
+	return findings, nil
+}
+
+func parseReviewFindings(response string) ([]reviewFinding, error) {
+	trimmed := strings.TrimSpace(response)
+	if start := strings.Index(trimmed, "{"); start >= 0 {
+		if end := strings.LastIndex(trimmed, "}"); end > start {
+			trimmed = trimmed[start : end+1]
+		}
+	}
+
+	var decoded struct {
+		Findings []reviewFinding `json:"findings"`
+	}
+	if err := json.Unmarshal([]byte(trimmed), &decoded); err != nil {
+		return nil, fmt.Errorf("decode review findings: %w", err)
+	}
+
+	findings := decoded.Findings[:0]
+	for _, finding := range decoded.Findings {
+		finding.File = strings.TrimPrefix(strings.TrimSpace(finding.File), "b/")
+		finding.Severity = strings.ToLower(strings.TrimSpace(finding.Severity))
+		finding.Message = strings.TrimSpace(finding.Message)
+		if finding.Message == "" {
+			continue
+		}
+		findings = append(findings, finding)
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		return severityRank(findings[i].Severity) < severityRank(findings[j].Severity)
+	})
+	return findings, nil
+}
+
+func severityRank(severity string) int {
+	switch severity {
+	case "high", "critical", "error":
+		return 0
+	case "medium", "warning":
+		return 1
+	case "low":
+		return 2
+	default:
+		return 3
+	}
+}
+
+func printReviewFindings(ctx *snap.Context, findings []reviewFinding, files []*stagedDiffFile) {
+	separator := strings.Repeat("─", 60)
+	fmt.Fprintf(ctx.Stdout(), "\nReview findings (%d):\n", len(findings))
+	for i, finding := range findings {
+		fmt.Fprintln(ctx.Stdout(), separator)
+		location := finding.File
+		if finding.Line > 0 {
+			location = fmt.Sprintf("%s:%d", finding.File, finding.Line)
+		}
+		severity := finding.Severity
+		if severity == "" {
+			severity = "note"
+		}
+		fmt.Fprintf(ctx.Stdout(), "%d. [%s] %s\n   %s\n", i+1, severity, location, finding.Message)
+
+		if excerpt := hunkExcerpt(files, finding.File, int(finding.Line)); excerpt != "" {
+			fmt.Fprintln(ctx.Stdout())
+			fmt.Fprint(ctx.Stdout(), excerpt)
+		}
+	}
+	fmt.Fprintln(ctx.Stdout(), separator)
+}
+
+// hunkExcerpt returns the lines of the staged hunk around line in the new
+// version of path, marking the line itself.
+func hunkExcerpt(files []*stagedDiffFile, path string, line int) string {
+	if line <= 0 {
+		return ""
+	}
+	for _, file := range files {
+		if file.path != path {
+			continue
+		}
+		for _, hunk := range file.hunks {
+			lines := strings.Split(strings.TrimRight(hunk, "\n"), "\n")
+			match := hunkHeaderPattern.FindStringSubmatch(lines[0])
+			if match == nil {
+				continue
+			}
+			newLine, _ := strconv.Atoi(match[1])
+
+			numbers := make([]int, len(lines))
+			target := -1
+			for i := 1; i < len(lines); i++ {
+				if strings.HasPrefix(lines[i], "-") || strings.HasPrefix(lines[i], `\`) {
+					continue
+				}
+				numbers[i] = newLine
+				if newLine == line {
+					target = i
+				}
+				newLine++
+			}
+			if target < 0 {
+				continue
+			}
+
+			start := target - reviewContextLines
+			if start < 1 {
+				start = 1
+			}
+			end := target + reviewContextLines
+			if end > len(lines)-1 {
+				end = len(lines) - 1
+			}
+
+			var excerpt strings.Builder
+			fmt.Fprintf(&excerpt, "   %s\n", lines[0])
+			for i := start; i <= end; i++ {
+				marker := "  "
+				if i == target {
+					marker = "▶ "
+				}
+				number := "    "
+				if numbers[i] > 0 {
+					number = fmt.Sprintf("%4d", numbers[i])
+				}
+				fmt.Fprintf(&excerpt, " %s%s %s\n", marker, number, lines[i])
+			}
+			return excerpt.String()
+		}
+	}
+	return ""
+}
+
+// openFileAtLine opens path in the configured editor, jumping to line for the
+// editors whose syntax for that is known, and returns once it is closed.
+func openFileAtLine(ctx *snap.Context, path string, line int) error {
+	if root, err := gitOutput("rev-parse", "--show-toplevel"); err == nil && !filepath.IsAbs(path) {
+		path = filepath.Join(strings.TrimSpace(root), path)
+	}
+
+	fields := strings.Fields(findEditor())
+	if len(fields) == 0 {
+		fields = []string{"vi"}
+	}
+	args := fields[1:]
+	// GUI editors return as soon as the file is open; --wait keeps the
+	// review from re-running before the fix is saved.
+	switch filepath.Base(fields[0]) {
+	case "code", "cursor", "code-insiders", "codium", "subl", "zed":
+		if !slices.Contains(args, "--wait") && !slices.Contains(args, "-w") {
+			args = append(args, "--wait")
+		}
+	}
+	if line > 0 {
+		switch filepath.Base(fields[0]) {
+		case "code", "cursor", "code-insiders", "codium":
+			args = append(args, "--goto", fmt.Sprintf("%s:%d", path, line))
+		case "subl", "zed", "hx", "helix":
+			args = append(args, fmt.Sprintf("%s:%d", path, line))
+		default:
+			args = append(args, fmt.Sprintf("+%d", line), path)
+		}
+	} else {
+		args = append(args, path)
+	}
+
+	cmd := exec.Command(fields[0], args...)
+	cmd.Stdout = ctx.Stdout()
+	cmd.Stderr = ctx.Stderr()
+	cmd.Stdin = ctx.Stdin()
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("open %s in %s: %w", path, fields[0], err)
+	}
+	return nil
+}
+
+var reviewCache = promptCache{subdir: "review", promptVersion: reviewPromptVersion}
+
+func loadReviewCache(key string) (*reviewCacheEntry, error) {
+	var entry reviewCacheEntry
+	ok, err := reviewCache.load(key, &entry)
+	if err != nil || !ok {
+		return nil, err
+	}
+	if !cacheEntryFresh(entry.Created, entry.Model) {
+		return nil, nil
+	}
+	return &entry, nil
+}
+
+func saveReviewCache(key string, findings []reviewFinding) error {
+	if findings == nil {
+		findings = []reviewFinding{}
+	}
+	return reviewCache.save(key, reviewCacheEntry{Created: time.Now(), Model: commitModelName, Findings: findings})
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/dzonerzy/go-snap/snap"
+)
+
+func runReword(ctx *snap.Context) error {
+	usage := fmt.Sprintf("Usage: %s reword [rev] [--force] [--offline] [--no-cache]", commandName)
+
+	var (
+		rev   string
+		force bool
+		opts  commitOptions
+	)
+	for i := 0; i < ctx.NArgs(); i++ {
+		arg := strings.TrimSpace(ctx.Arg(i))
+		if arg == "" {
+			continue
+		}
+
+		switch {
+		case arg == "--force":
+			force = true
+		case arg == "--offline":
+			opts.offline = true
+		case arg == "--no-cache":
+			opts.noCache = true
+		case strings.HasPrefix(arg, "--"):
+			fmt.Fprintln(ctx.Stderr(), usage)
+			return fmt.Errorf("unknown flag %q", arg)
+		case rev == "":
+			rev = arg
+		default:
+			fmt.Fprintln(ctx.Stderr(), usage)
+			return fmt.Errorf("unexpected argument %q", arg)
+		}
+	}
+	if rev == "" {
+		rev = "HEAD"
+	}
+
+	if err := ensureGitRepository(); err != nil {
+		return reportError(ctx, err)
+	}
+
+	sha, err := resolveCommitSHA(rev)
+	if err != nil {
+		return reportError(ctx, err)
+	}
+	head, err := resolveCommitSHA("HEAD")
+	if err != nil {
+		return reportError(ctx, err)
+	}
+
+	isHead := sha == head
+	if !isHead {
+		if err := exec.Command("git", "merge-base", "--is-ancestor", sha, head).Run(); err != nil {
+			return reportError(ctx, fmt.Errorf("%s is not an ancestor of HEAD; check out the branch that contains it first", rev))
+		}
+	}
+
+	if !force {
+		remotes, err := remoteBranchesContaining(sha)
+		if err != nil {
+			return reportError(ctx, err)
+		}
+		if len(remotes) > 0 {
+			return reportError(ctx, fmt.Errorf("%s is already pushed to %s; rerun with --force to rewrite it anyway", shortSHA(sha), strings.Join(remotes, ", ")))
+		}
+	}
+
+	source := commitDiffSourceFor(sha)
+	diffOutput, err := exec.Command("git", "show", "--format=", "--diff-merges=first-parent", sha).Output()
+	if err != nil {
+		return reportError(ctx, fmt.Errorf("git show %s: %w", shortSHA(sha), err))
+	}
+	diff := string(diffOutput)
+	if strings.TrimSpace(diff) == "" {
+		return reportError(ctx, fmt.Errorf("commit %s has no changes to describe", shortSHA(sha)))
+	}
+
+	currentMessage, err := gitOutput("log", "-1", "--format=%B", sha)
+	if err != nil {
+		return reportError(ctx, err)
+	}
+	fmt.Fprintf(ctx.Stdout(), "Current message of %s:\n%s\n\n", shortSHA(sha), strings.TrimSpace(currentMessage))
+
+	payload, err := generateCommitPayload(ctx, opts, source, diff, "")
+	if err != nil {
+		return err
+	}
+
+	updatedMessage, confirmed, err := promptCommitConfirmation(ctx, payload)
+	if err != nil {
+		return reportError(ctx, err)
+	}
+	if !confirmed {
+		fmt.Fprintln(ctx.Stdout(), "Reword cancelled.")
+		return nil
+	}
+	if err := payload.setMessage(updatedMessage); err != nil {
+		return reportError(ctx, err)
+	}
+	payload.applyTrailers(ctx, parseCommitTrailers(currentMessage))
+
+	if isHead {
+		args := []string{"commit", "--amend", "--only"}
+		for _, paragraph := range payload.paragraphs {
+			args = append(args, "-m", paragraph)
+		}
+		if err := runGitCommandStreaming(ctx, args...); err != nil {
+			return reportError(ctx, fmt.Errorf("git commit --amend: %w", err))
+		}
+		if isFlowCommit(sha) {
+			recordFlowCommit()
+		}
+		fmt.Fprintf(ctx.Stdout(), "✔️ Reworded HEAD: %s\n", payload.paragraphs[0])
+		return nil
+	}
+
+	rewritten, err := commitTreeWithMessage(sha, strings.Join(payload.paragraphs, "\n\n"))
+	if err != nil {
+		return reportError(ctx, err)
+	}
+
+	rebased, err := gitOutput("rev-list", "--topo-order", "--reverse", sha+".."+head)
+	if err != nil {
+		return reportError(ctx, err)
+	}
+	before := append([]string{sha}, strings.Fields(rebased)...)
+
+	if err := runGitCommandStreaming(ctx, "rebase", "--rebase-merges", "--autostash", "--onto", rewritten, sha); err != nil {
+		// Where the rebase ends up is not known yet, so stop vouching for
+		// the old commits.
+		remapFlowCommits(before, nil)
+		fmt.Fprintln(ctx.Stderr(), "Rebase stopped; resolve it with git rebase --continue or git rebase --abort.")
+		return reportError(ctx, fmt.Errorf("git rebase --onto %s %s: %w", shortSHA(rewritten), shortSHA(sha), err))
+	}
+
+	var after []string
+	if out, err := gitOutput("rev-list", "--topo-order", "--reverse", rewritten+"..HEAD"); err == nil {
+		after = append([]string{rewritten}, strings.Fields(out)...)
+	}
+	remapFlowCommits(before, after)
+
+	fmt.Fprintf(ctx.Stdout(), "✔️ Reworded %s -> %s: %s\n", shortSHA(sha), shortSHA(rewritten), payload.paragraphs[0])
+	return nil
+}
+
+func (p *commitPayload) setMessage(message string) error {
+	trimmed := strings.TrimSpace(message)
+	if trimmed == "" {
+		return fmt.Errorf("commit message is empty after editing")
+	}
+	paragraphs := splitCommitMessageParagraphs(trimmed)
+	if len(paragraphs) == 0 {
+		return fmt.Errorf("commit message is empty after formatting")
+	}
+	p.message = trimmed
+	p.paragraphs = paragraphs
+	return nil
+}
+
+// commitTreeWithMessage recreates sha with the same tree, parents and author
+// but a new message, returning the new commit id.
+func commitTreeWithMessage(sha string, message string) (string, error) {
+	info, err := gitOutput("log", "-1", "--format=%T%x00%P%x00%an%x00%ae%x00%ad", "--date=raw", sha)
+	if err != nil {
+		return "", err
+	}
+	fields := strings.Split(strings.TrimRight(info, "\n"), "\x00")
+	if len(fields) != 5 {
+		return "", fmt.Errorf("unexpected git log output for %s", shortSHA(sha))
+	}
+
+	args := []string{"commit-tree", fields[0]}
+	for _, parent := range strings.Fields(fields[1]) {
+		args = append(args, "-p", parent)
+	}
+	args = append(args, "-F", "-")
+
+	cmd := exec.Command("git", args...)
+	cmd.Stdin = strings.NewReader(message + "\n")
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME="+fields[2],
+		"GIT_AUTHOR_EMAIL="+fields[3],
+		"GIT_AUTHOR_DATE="+fields[4],
+	)
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git commit-tree: %w", err)
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+func resolveCommitSHA(rev string) (string, error) {
+	out, err := exec.Command("git", "rev-parse", "--verify", "--quiet", rev+"^{commit}").Output()
+	if err != nil {
+		return "", fmt.Errorf("unknown revision %q", rev)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func remoteBranchesContaining(sha string) ([]string, error) {
+	out, err := exec.Command("git", "branch", "-r", "--format=%(refname)", "--contains", sha).Output()
+	if err != nil {
+		return nil, fmt.Errorf("git branch -r --contains %s: %w", shortSHA(sha), err)
+	}
+
+	var branches []string
+	for _, line := range strings.Split(string(out), "\n") {
+		name := strings.TrimPrefix(strings.TrimSpace(line), "refs/remotes/")
+		if name == "" || strings.HasSuffix(name, "/HEAD") {
+			continue
+		}
+		branches = append(branches, name)
+	}
+	return branches, nil
+}
+
+func gitOutput(args ...string) (string, error) {
+	out, err := exec.Command("git", args...).Output()
+	if err != nil {
+		var stderr string
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			stderr = strings.TrimSpace(string(exitErr.Stderr))
+		}
+		if stderr != "" {
+			return "", fmt.Errorf("git %s: %s", strings.Join(args, " "), stderr)
+		}
+		return "", fmt.Errorf("git %s: %w", strings.Join(args, " "), err)
+	}
+	return string(out), nil
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
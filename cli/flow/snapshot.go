@@ -0,0 +1,368 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/dzonerzy/go-snap/snap"
+)
+
+const (
+	snapshotRefPrefix = "refs/flow/snapshots/"
+	snapshotIndexFile = "FLOW_SNAPSHOT_INDEX"
+	// maxSnapshotsListed bounds how far back snapshot list walks.
+	maxSnapshotsListed = 50
+)
+
+type worktreeSnapshot struct {
+	sha     string
+	head    string
+	when    string
+	message string
+}
+
+func runSnapshot(ctx *snap.Context) error {
+	usage := fmt.Sprintf("Usage: %s snapshot [-m <message>] | list [branch] | diff [n] [--stat] | restore [n] [--yes]", commandName)
+
+	var args []string
+	for i := 0; i < ctx.NArgs(); i++ {
+		if arg := strings.TrimSpace(ctx.Arg(i)); arg != "" {
+			args = append(args, arg)
+		}
+	}
+
+	if err := ensureGitRepository(); err != nil {
+		return reportError(ctx, err)
+	}
+
+	sub := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		sub, args = args[0], args[1:]
+	}
+
+	switch sub {
+	case "", "save":
+		message := ""
+		for i := 0; i < len(args); i++ {
+			switch {
+			case args[i] == "-m" || args[i] == "--message":
+				i++
+				if i >= len(args) {
+					fmt.Fprintln(ctx.Stderr(), usage)
+					return fmt.Errorf("%s requires a value", args[i-1])
+				}
+				message = args[i]
+			case strings.HasPrefix(args[i], "--message="):
+				message = strings.TrimPrefix(args[i], "--message=")
+			default:
+				fmt.Fprintln(ctx.Stderr(), usage)
+				return fmt.Errorf("unexpected argument %q", args[i])
+			}
+		}
+		if message == "" {
+			message = "manual snapshot"
+		}
+		snapshot, created, err := takeSnapshot(message)
+		if err != nil {
+			return reportError(ctx, err)
+		}
+		if !created {
+			fmt.Fprintf(ctx.Stdout(), "ℹ️ Nothing changed since snapshot %s\n", shortSHA(snapshot))
+			return nil
+		}
+		fmt.Fprintf(ctx.Stdout(), "✔️ Saved snapshot %s: %s\n", shortSHA(snapshot), message)
+		return nil
+	case "list":
+		if len(args) > 1 {
+			fmt.Fprintln(ctx.Stderr(), usage)
+			return fmt.Errorf("unexpected argument %q", args[1])
+		}
+		branch := ""
+		if len(args) == 1 {
+			branch = args[0]
+		}
+		return listSnapshots(ctx, branch)
+	case "diff":
+		stat := false
+		selector := ""
+		for _, arg := range args {
+			switch {
+			case arg == "--stat":
+				stat = true
+			case selector == "" && !strings.HasPrefix(arg, "-"):
+				selector = arg
+			default:
+				fmt.Fprintln(ctx.Stderr(), usage)
+				return fmt.Errorf("unexpected argument %q", arg)
+			}
+		}
+		return diffSnapshot(ctx, selector, stat)
+	case "restore":
+		assumeYes := false
+		selector := ""
+		for _, arg := range args {
+			switch {
+			case arg == "--yes" || arg == "-y":
+				assumeYes = true
+			case selector == "" && !strings.HasPrefix(arg, "-"):
+				selector = arg
+			default:
+				fmt.Fprintln(ctx.Stderr(), usage)
+				return fmt.Errorf("unexpected argument %q", arg)
+			}
+		}
+		return restoreSnapshot(ctx, selector, assumeYes)
+	default:
+		fmt.Fprintln(ctx.Stderr(), usage)
+		return fmt.Errorf("unknown snapshot command %q", sub)
+	}
+}
+
+// takeSnapshot records the working tree, untracked files included, as a
+// commit on the current branch's snapshot ref. HEAD, the index and the stash
+// are left alone. It reports false when nothing changed since the last one.
+func takeSnapshot(message string) (string, bool, error) {
+	head, err := resolveCommitSHA("HEAD")
+	if err != nil {
+		return "", false, fmt.Errorf("snapshots need at least one commit: %w", err)
+	}
+	tree, err := worktreeTree()
+	if err != nil {
+		return "", false, err
+	}
+
+	ref := snapshotRef("")
+	previous := ""
+	if out, err := gitOutput("rev-parse", "--verify", "--quiet", ref); err == nil {
+		previous = strings.TrimSpace(out)
+		info, _ := gitOutput("log", "-1", "--format=%T %P", previous)
+		fields := strings.Fields(info)
+		if len(fields) > 1 && fields[0] == tree && fields[len(fields)-1] == head {
+			return previous, false, nil
+		}
+	}
+
+	// The previous snapshot is the first parent, so snapshots of a branch
+	// form a first-parent chain; HEAD at the time is always the last parent.
+	args := []string{"commit-tree", tree}
+	if previous != "" {
+		args = append(args, "-p", previous)
+	}
+	args = append(args, "-p", head, "-m", message)
+	out, err := gitOutput(args...)
+	if err != nil {
+		return "", false, err
+	}
+	snapshot := strings.TrimSpace(out)
+
+	if err := exec.Command("git", "update-ref", "-m", "snapshot: "+message, ref, snapshot).Run(); err != nil {
+		return "", false, fmt.Errorf("git update-ref %s: %w", ref, err)
+	}
+	return snapshot, true, nil
+}
+
+// autoSnapshot takes a snapshot before a risky operation. Failures only warn,
+// so they never block the operation itself.
+func autoSnapshot(ctx *snap.Context, operation string) {
+	snapshot, created, err := takeSnapshot("before " + operation)
+	if err != nil {
+		fmt.Fprintf(ctx.Stderr(), "⚠️ Could not snapshot the working tree: %v\n", err)
+		return
+	}
+	if created {
+		fmt.Fprintf(ctx.Stderr(), "ℹ️ Saved snapshot %s before %s; %s snapshot restore brings it back\n", shortSHA(snapshot), operation, commandName)
+	}
+}
+
+// worktreeTree writes the working tree, untracked but not ignored files
+// included, as a tree through a scratch index.
+func worktreeTree() (string, error) {
+	indexPath, err := gitOutput("rev-parse", "--git-path", snapshotIndexFile)
+	if err != nil {
+		return "", err
+	}
+	indexPath = strings.TrimSpace(indexPath)
+	defer os.Remove(indexPath)
+
+	// Starting from a copy of the real index keeps git's stat cache, so
+	// unchanged files are not rehashed.
+	if realIndex, err := gitOutput("rev-parse", "--git-path", "index"); err == nil {
+		if data, err := os.ReadFile(strings.TrimSpace(realIndex)); err == nil {
+			if err := os.WriteFile(indexPath, data, 0o644); err != nil {
+				return "", fmt.Errorf("copy index: %w", err)
+			}
+		}
+	}
+
+	env := append(os.Environ(), "GIT_INDEX_FILE="+indexPath)
+	add := exec.Command("git", "add", "--all", "--", ":/")
+	add.Env = env
+	if out, err := add.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("git add --all: %s", strings.TrimSpace(string(out)))
+	}
+	write := exec.Command("git", "write-tree")
+	write.Env = env
+	out, err := write.Output()
+	if err != nil {
+		return "", fmt.Errorf("git write-tree: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func snapshotRef(branch string) string {
+	if branch == "" {
+		if current, err := currentGitBranch(); err == nil {
+			branch = current
+		}
+	}
+	if branch == "" || branch == "HEAD" {
+		branch = "detached"
+	}
+	return snapshotRefPrefix + branch
+}
+
+// loadSnapshots returns a branch's snapshots, newest first.
+func loadSnapshots(branch string) ([]worktreeSnapshot, error) {
+	ref := snapshotRef(branch)
+	if exists, err := gitRefExists(ref); err != nil {
+		return nil, err
+	} else if !exists {
+		return nil, nil
+	}
+
+	out, err := gitOutput("log", "--first-parent", "-n", strconv.Itoa(maxSnapshotsListed), "--format=%H%x00%P%x00%cr%x00%s", ref)
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshots []worktreeSnapshot
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		fields := strings.SplitN(line, "\x00", 4)
+		if len(fields) != 4 {
+			continue
+		}
+		parents := strings.Fields(fields[1])
+		if len(parents) == 0 {
+			break
+		}
+		snapshots = append(snapshots, worktreeSnapshot{sha: fields[0], head: parents[len(parents)-1], when: fields[2], message: fields[3]})
+		// The oldest snapshot has HEAD as its only parent; past it the
+		// first-parent walk is in the branch's own history.
+		if len(parents) == 1 {
+			break
+		}
+	}
+	return snapshots, nil
+}
+
+// resolveSnapshot picks a snapshot of the current branch by position (0 is
+// the newest) or by commit id.
+func resolveSnapshot(selector string) (worktreeSnapshot, error) {
+	snapshots, err := loadSnapshots("")
+	if err != nil {
+		return worktreeSnapshot{}, err
+	}
+	if len(snapshots) == 0 {
+		return worktreeSnapshot{}, fmt.Errorf("no snapshots for this branch; take one with %s snapshot", commandName)
+	}
+	if selector == "" {
+		return snapshots[0], nil
+	}
+	if n, err := strconv.Atoi(selector); err == nil && len(selector) < 4 {
+		if n < 0 || n >= len(snapshots) {
+			return worktreeSnapshot{}, fmt.Errorf("snapshot %d does not exist; %s snapshot list shows %d", n, commandName, len(snapshots))
+		}
+		return snapshots[n], nil
+	}
+	for _, snapshot := range snapshots {
+		if strings.HasPrefix(snapshot.sha, selector) {
+			return snapshot, nil
+		}
+	}
+	return worktreeSnapshot{}, fmt.Errorf("no snapshot matches %q", selector)
+}
+
+func listSnapshots(ctx *snap.Context, branch string) error {
+	snapshots, err := loadSnapshots(branch)
+	if err != nil {
+		return reportError(ctx, err)
+	}
+	if len(snapshots) == 0 {
+		fmt.Fprintf(ctx.Stdout(), "No snapshots on %s.\n", strings.TrimPrefix(snapshotRef(branch), snapshotRefPrefix))
+		return nil
+	}
+	for i, snapshot := range snapshots {
+		fmt.Fprintf(ctx.Stdout(), "%3d  %s  %-16s  %s (on %s)\n", i, shortSHA(snapshot.sha), snapshot.when, snapshot.message, shortSHA(snapshot.head))
+	}
+	return nil
+}
+
+// diffSnapshot compares a snapshot with the working tree as it is now,
+// untracked files included.
+func diffSnapshot(ctx *snap.Context, selector string, stat bool) error {
+	snapshot, err := resolveSnapshot(selector)
+	if err != nil {
+		return reportError(ctx, err)
+	}
+	tree, err := worktreeTree()
+	if err != nil {
+		return reportError(ctx, err)
+	}
+
+	args := []string{"diff"}
+	if stat {
+		args = append(args, "--stat")
+	}
+	args = append(args, snapshot.sha+"^{tree}", tree)
+	if err := runGitCommandStreaming(ctx, args...); err != nil {
+		return reportError(ctx, fmt.Errorf("git diff: %w", err))
+	}
+	return nil
+}
+
+// restoreSnapshot writes a snapshot's files back into the working tree. HEAD
+// and the index stay as they are, and the current state is snapshotted first.
+func restoreSnapshot(ctx *snap.Context, selector string, assumeYes bool) error {
+	snapshot, err := resolveSnapshot(selector)
+	if err != nil {
+		return reportError(ctx, err)
+	}
+
+	fmt.Fprintf(ctx.Stdout(), "Snapshot %s (%s, %s) differs from the working tree in:\n", shortSHA(snapshot.sha), snapshot.message, snapshot.when)
+	if err := diffSnapshot(ctx, snapshot.sha, true); err != nil {
+		return err
+	}
+	if !assumeYes {
+		fmt.Fprint(ctx.Stdout(), "Restore these files? [y/n]: ")
+		choice, err := readConfirmationChoice(ctx)
+		fmt.Fprintln(ctx.Stdout())
+		if err != nil {
+			return reportError(ctx, fmt.Errorf("reading choice: %w", err))
+		}
+		if strings.ToLower(string(choice)) != "y" {
+			fmt.Fprintln(ctx.Stdout(), "Restore cancelled.")
+			return nil
+		}
+	}
+
+	autoSnapshot(ctx, "snapshot restore")
+
+	// Files missing from the snapshot are removed only when tracked;
+	// untracked files that did not exist then are left in place.
+	cmd := exec.Command("git", "restore", "--source="+snapshot.sha, "--worktree", "--no-overlay", "--", ":/")
+	cmd.Stdout = io.Discard
+	cmd.Stderr = ctx.Stderr()
+	if err := cmd.Run(); err != nil {
+		return reportError(ctx, fmt.Errorf("git restore --source=%s: %w", shortSHA(snapshot.sha), err))
+	}
+
+	fmt.Fprintf(ctx.Stdout(), "✔️ Restored the working tree from snapshot %s\n", shortSHA(snapshot.sha))
+	if head, err := resolveCommitSHA("HEAD"); err == nil && head != snapshot.head {
+		fmt.Fprintf(ctx.Stdout(), "ℹ️ The snapshot was taken on %s; HEAD is now %s, so git status shows the difference\n", shortSHA(snapshot.head), shortSHA(head))
+	}
+	return nil
+}
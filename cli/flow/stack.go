@@ -0,0 +1,619 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/dzonerzy/go-snap/snap"
+)
+
+const (
+	// stackParentKey and stackBaseKey live under branch.<name>. The base is
+	// the parent commit the branch was last stacked on, which is what rebase
+	// --onto needs once the parent has been rewritten.
+	stackParentKey   = "flowParent"
+	stackBaseKey     = "flowParentBase"
+	stackRestackFile = "FLOW_STACK_RESTACK"
+)
+
+// restackState is what a paused restack needs to resume: the branch to
+// return to and the branches still to rebase, the conflicted one first.
+type restackState struct {
+	original string
+	queue    []string
+}
+
+func runStack(ctx *snap.Context) error {
+	usage := fmt.Sprintf("Usage: %s stack [show] | new <branch> | track [parent] | untrack [branch] | restack [--continue|--abort] | push [--remote <remote>]", commandName)
+
+	var args []string
+	for i := 0; i < ctx.NArgs(); i++ {
+		if arg := strings.TrimSpace(ctx.Arg(i)); arg != "" {
+			args = append(args, arg)
+		}
+	}
+
+	if err := ensureGitRepository(); err != nil {
+		return reportError(ctx, err)
+	}
+
+	sub := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		sub, args = args[0], args[1:]
+	}
+
+	switch sub {
+	case "", "show":
+		if len(args) > 0 {
+			fmt.Fprintln(ctx.Stderr(), usage)
+			return fmt.Errorf("unexpected argument %q", args[0])
+		}
+		return reportError(ctx, showStacks(ctx))
+	case "new":
+		if len(args) != 1 || strings.HasPrefix(args[0], "-") {
+			fmt.Fprintln(ctx.Stderr(), usage)
+			return fmt.Errorf("stack new needs exactly one branch name")
+		}
+		return reportError(ctx, newStackBranch(ctx, args[0]))
+	case "track":
+		if len(args) > 1 || (len(args) == 1 && strings.HasPrefix(args[0], "-")) {
+			fmt.Fprintln(ctx.Stderr(), usage)
+			return fmt.Errorf("unexpected argument %q", args[len(args)-1])
+		}
+		parent := ""
+		if len(args) == 1 {
+			parent = args[0]
+		}
+		return reportError(ctx, trackStackBranch(ctx, parent))
+	case "untrack":
+		if len(args) > 1 || (len(args) == 1 && strings.HasPrefix(args[0], "-")) {
+			fmt.Fprintln(ctx.Stderr(), usage)
+			return fmt.Errorf("unexpected argument %q", args[len(args)-1])
+		}
+		branch := ""
+		if len(args) == 1 {
+			branch = args[0]
+		}
+		return reportError(ctx, untrackStackBranch(ctx, branch))
+	case "restack":
+		mode := ""
+		for _, arg := range args {
+			switch {
+			case (arg == "--continue" || arg == "--abort") && mode == "":
+				mode = arg
+			default:
+				fmt.Fprintln(ctx.Stderr(), usage)
+				return fmt.Errorf("unexpected argument %q", arg)
+			}
+		}
+		switch mode {
+		case "--continue":
+			return reportError(ctx, continueRestack(ctx))
+		case "--abort":
+			return reportError(ctx, abortRestack(ctx))
+		default:
+			return reportError(ctx, startRestack(ctx))
+		}
+	case "push":
+		remote := ""
+		for i := 0; i < len(args); i++ {
+			switch {
+			case args[i] == "--remote":
+				i++
+				if i >= len(args) {
+					fmt.Fprintln(ctx.Stderr(), usage)
+					return fmt.Errorf("--remote requires a value")
+				}
+				remote = args[i]
+			case strings.HasPrefix(args[i], "--remote="):
+				remote = strings.TrimPrefix(args[i], "--remote=")
+			default:
+				fmt.Fprintln(ctx.Stderr(), usage)
+				return fmt.Errorf("unexpected argument %q", args[i])
+			}
+		}
+		return reportError(ctx, pushStack(ctx, remote))
+	default:
+		fmt.Fprintln(ctx.Stderr(), usage)
+		return fmt.Errorf("unknown stack command %q", sub)
+	}
+}
+
+// loadStackParents returns every tracked branch mapped to its parent,
+// skipping branches that have since been deleted.
+func loadStackParents() (map[string]string, error) {
+	parents := map[string]string{}
+	out, err := exec.Command("git", "config", "--get-regexp", `^branch\..*\.`+strings.ToLower(stackParentKey)+`$`).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			// No matching keys.
+			return parents, nil
+		}
+		return nil, fmt.Errorf("git config --get-regexp: %w", err)
+	}
+	suffix := "." + strings.ToLower(stackParentKey)
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		key, parent, ok := strings.Cut(line, " ")
+		if !ok || parent == "" {
+			continue
+		}
+		branch := strings.TrimSuffix(strings.TrimPrefix(key, "branch."), suffix)
+		if exists, _ := gitRefExists("refs/heads/" + branch); !exists {
+			continue
+		}
+		parents[branch] = parent
+	}
+	return parents, nil
+}
+
+func stackChildren(parents map[string]string) map[string][]string {
+	children := map[string][]string{}
+	for branch, parent := range parents {
+		children[parent] = append(children[parent], branch)
+	}
+	for _, list := range children {
+		sort.Strings(list)
+	}
+	return children
+}
+
+// stackBranches returns the tracked branches in the stack containing branch,
+// parents before children. The stack starts at the lowest tracked ancestor;
+// for an untracked branch such as main it is everything stacked on top.
+func stackBranches(parents map[string]string, branch string) []string {
+	root := branch
+	seen := map[string]bool{root: true}
+	for {
+		parent, ok := parents[root]
+		if !ok {
+			break
+		}
+		if _, tracked := parents[parent]; !tracked || seen[parent] {
+			break
+		}
+		seen[parent] = true
+		root = parent
+	}
+
+	children := stackChildren(parents)
+	var order []string
+	visited := map[string]bool{}
+	var walk func(string)
+	walk = func(name string) {
+		if visited[name] {
+			return
+		}
+		visited[name] = true
+		if _, tracked := parents[name]; tracked {
+			order = append(order, name)
+		}
+		for _, child := range children[name] {
+			walk(child)
+		}
+	}
+	walk(root)
+	return order
+}
+
+// stackIsStale reports whether parent has moved past the point branch was
+// stacked on.
+func stackIsStale(branch, parent string) bool {
+	return exec.Command("git", "merge-base", "--is-ancestor", "refs/heads/"+parent, "refs/heads/"+branch).Run() != nil
+}
+
+// stackBase returns the commit branch was stacked on, falling back to its
+// merge base with parent when none was recorded.
+func stackBase(branch, parent string) (string, error) {
+	if base := gitConfigValue("branch." + branch + "." + stackBaseKey); base != "" {
+		if sha, err := resolveCommitSHA(base); err == nil {
+			return sha, nil
+		}
+	}
+	out, err := gitOutput("merge-base", "refs/heads/"+parent, "refs/heads/"+branch)
+	if err != nil {
+		return "", fmt.Errorf("%s and %s share no history", branch, parent)
+	}
+	return strings.TrimSpace(out), nil
+}
+
+func setStackParent(branch, parent, base string) error {
+	if err := exec.Command("git", "config", "branch."+branch+"."+stackParentKey, parent).Run(); err != nil {
+		return fmt.Errorf("record parent of %s: %w", branch, err)
+	}
+	return setStackBase(branch, base)
+}
+
+func setStackBase(branch, base string) error {
+	if err := exec.Command("git", "config", "branch."+branch+"."+stackBaseKey, base).Run(); err != nil {
+		return fmt.Errorf("record base of %s: %w", branch, err)
+	}
+	return nil
+}
+
+func showStacks(ctx *snap.Context) error {
+	parents, err := loadStackParents()
+	if err != nil {
+		return err
+	}
+	if len(parents) == 0 {
+		fmt.Fprintf(ctx.Stdout(), "ℹ️ No stacked branches; start one with %s stack new <branch> or %s stack track\n", commandName, commandName)
+		return nil
+	}
+	current, _ := currentGitBranch()
+	children := stackChildren(parents)
+
+	var roots []string
+	for parent := range children {
+		if _, tracked := parents[parent]; !tracked {
+			roots = append(roots, parent)
+		}
+	}
+	sort.Strings(roots)
+
+	label := func(name string) string {
+		if name == current {
+			return name + " *"
+		}
+		return name
+	}
+
+	var printTree func(name, indent string)
+	printTree = func(name, indent string) {
+		list := children[name]
+		for i, child := range list {
+			branchGlyph, nextIndent := "├── ", indent+"│   "
+			if i == len(list)-1 {
+				branchGlyph, nextIndent = "└── ", indent+"    "
+			}
+			line := label(child)
+			if out, err := gitOutput("rev-list", "--count", "refs/heads/"+name+"..refs/heads/"+child); err == nil {
+				count := strings.TrimSpace(out)
+				if count == "1" {
+					line += "  1 commit"
+				} else {
+					line += "  " + count + " commits"
+				}
+			}
+			if stackIsStale(child, name) {
+				line += "  (needs restack)"
+			}
+			fmt.Fprintf(ctx.Stdout(), "%s%s%s\n", indent, branchGlyph, line)
+			printTree(child, nextIndent)
+		}
+	}
+
+	for i, root := range roots {
+		if i > 0 {
+			fmt.Fprintln(ctx.Stdout())
+		}
+		fmt.Fprintln(ctx.Stdout(), label(root))
+		printTree(root, "")
+	}
+	return nil
+}
+
+// newStackBranch creates branch on top of the current one and records the
+// current branch as its parent.
+func newStackBranch(ctx *snap.Context, branch string) error {
+	parent, err := currentGitBranch()
+	if err != nil {
+		return err
+	}
+	if parent == "HEAD" {
+		return fmt.Errorf("HEAD is detached; check out the branch to stack on first")
+	}
+	head, err := resolveCommitSHA("HEAD")
+	if err != nil {
+		return err
+	}
+	if err := runGitCommandStreaming(ctx, "checkout", "-b", branch); err != nil {
+		return fmt.Errorf("git checkout -b %s: %w", branch, err)
+	}
+	if err := setStackParent(branch, parent, head); err != nil {
+		return err
+	}
+	fmt.Fprintf(ctx.Stdout(), "✔️ Created %s on top of %s\n", branch, parent)
+	return nil
+}
+
+// trackStackBranch records parent as the parent of the current branch,
+// defaulting to the repository's default branch.
+func trackStackBranch(ctx *snap.Context, parent string) error {
+	branch, err := currentGitBranch()
+	if err != nil {
+		return err
+	}
+	if branch == "HEAD" {
+		return fmt.Errorf("HEAD is detached; check out the branch to track first")
+	}
+	if parent == "" {
+		parent = detectBaseBranch("origin")
+	}
+	if parent == branch {
+		return fmt.Errorf("%s cannot be its own parent", branch)
+	}
+	if exists, err := gitRefExists("refs/heads/" + parent); err != nil {
+		return err
+	} else if !exists {
+		return fmt.Errorf("local branch %s not found", parent)
+	}
+
+	parents, err := loadStackParents()
+	if err != nil {
+		return err
+	}
+	for ancestor, ok := parents[parent]; ok; ancestor, ok = parents[ancestor] {
+		if ancestor == branch {
+			return fmt.Errorf("%s is stacked on %s already; tracking it as the parent would make a loop", parent, branch)
+		}
+	}
+
+	// A recorded base only makes sense against the parent it came from.
+	if parents[branch] != parent {
+		_ = exec.Command("git", "config", "--unset", "branch."+branch+"."+stackBaseKey).Run()
+	}
+	base, err := stackBase(branch, parent)
+	if err != nil {
+		return err
+	}
+	if err := setStackParent(branch, parent, base); err != nil {
+		return err
+	}
+	fmt.Fprintf(ctx.Stdout(), "✔️ %s is now stacked on %s\n", branch, parent)
+	if stackIsStale(branch, parent) {
+		fmt.Fprintf(ctx.Stdout(), "ℹ️ %s has moved since %s branched off; run %s stack restack\n", parent, branch, commandName)
+	}
+	return nil
+}
+
+// untrackStackBranch forgets branch's parent. Branches stacked on it stay
+// tracked and now start a stack of their own.
+func untrackStackBranch(ctx *snap.Context, branch string) error {
+	if branch == "" {
+		current, err := currentGitBranch()
+		if err != nil {
+			return err
+		}
+		branch = current
+	}
+	if gitConfigValue("branch."+branch+"."+stackParentKey) == "" {
+		return fmt.Errorf("%s is not part of a stack", branch)
+	}
+	for _, key := range []string{stackParentKey, stackBaseKey} {
+		_ = exec.Command("git", "config", "--unset", "branch."+branch+"."+key).Run()
+	}
+	fmt.Fprintf(ctx.Stdout(), "✔️ %s is no longer stacked\n", branch)
+	return nil
+}
+
+func startRestack(ctx *snap.Context) error {
+	if _, err := loadRestackState(); err == nil {
+		return fmt.Errorf("a restack is already in progress; run %s stack restack --continue or --abort", commandName)
+	}
+	current, err := currentGitBranch()
+	if err != nil {
+		return err
+	}
+	if current == "HEAD" {
+		return fmt.Errorf("HEAD is detached; check out a branch in the stack first")
+	}
+	if status, err := gitOutput("status", "--porcelain", "--untracked-files=no"); err != nil {
+		return err
+	} else if strings.TrimSpace(status) != "" {
+		return fmt.Errorf("commit or stash your changes before restacking")
+	}
+
+	parents, err := loadStackParents()
+	if err != nil {
+		return err
+	}
+	queue := stackBranches(parents, current)
+	if len(queue) == 0 {
+		return fmt.Errorf("%s is not part of a stack; use %s stack new or %s stack track", current, commandName, commandName)
+	}
+	return runRestackQueue(ctx, restackState{original: current, queue: queue}, parents, false)
+}
+
+func continueRestack(ctx *snap.Context) error {
+	state, err := loadRestackState()
+	if err != nil {
+		return err
+	}
+	if rebaseInProgress() {
+		cmd := exec.Command("git", "rebase", "--continue")
+		cmd.Env = append(os.Environ(), "GIT_EDITOR=true")
+		cmd.Stdout = ctx.Stdout()
+		cmd.Stderr = ctx.Stderr()
+		cmd.Stdin = ctx.Stdin()
+		if err := cmd.Run(); err != nil {
+			fmt.Fprintf(ctx.Stderr(), "Rebase stopped again; resolve it, git add the files and run %s stack restack --continue.\n", commandName)
+			return fmt.Errorf("git rebase --continue: %w", err)
+		}
+	}
+	parents, err := loadStackParents()
+	if err != nil {
+		return err
+	}
+	return runRestackQueue(ctx, state, parents, true)
+}
+
+func abortRestack(ctx *snap.Context) error {
+	state, err := loadRestackState()
+	if err != nil {
+		return err
+	}
+	if rebaseInProgress() {
+		if err := runGitCommandStreaming(ctx, "rebase", "--abort"); err != nil {
+			return fmt.Errorf("git rebase --abort: %w", err)
+		}
+	}
+	clearRestackState()
+	if err := runGitCommandStreaming(ctx, "checkout", "--quiet", state.original); err != nil {
+		return fmt.Errorf("git checkout %s: %w", state.original, err)
+	}
+	fmt.Fprintf(ctx.Stdout(), "ℹ️ Restack aborted; %s was left as it was, branches restacked before it keep their new commits\n", state.queue[0])
+	return nil
+}
+
+// runRestackQueue rebases each queued branch onto its parent's current tip,
+// saving the queue before every rebase so a conflict can be resumed.
+func runRestackQueue(ctx *snap.Context, state restackState, parents map[string]string, resumed bool) error {
+	restacked := 0
+	for len(state.queue) > 0 {
+		branch := state.queue[0]
+		parent, ok := parents[branch]
+		if !ok {
+			state.queue = state.queue[1:]
+			continue
+		}
+		parentTip, err := resolveCommitSHA("refs/heads/" + parent)
+		if err != nil {
+			return err
+		}
+
+		if stackIsStale(branch, parent) {
+			base, err := stackBase(branch, parent)
+			if err != nil {
+				return err
+			}
+			if err := saveRestackState(state); err != nil {
+				return err
+			}
+			fmt.Fprintf(ctx.Stdout(), "ℹ️ Restacking %s onto %s\n", branch, parent)
+			if err := runGitCommandStreaming(ctx, "rebase", "--onto", parentTip, base, branch); err != nil {
+				fmt.Fprintf(ctx.Stderr(), "Rebase of %s stopped; resolve it, git add the files and run %s stack restack --continue (or --abort).\n", branch, commandName)
+				return fmt.Errorf("git rebase --onto %s %s %s: %w", parent, shortSHA(base), branch, err)
+			}
+			restacked++
+		}
+		if err := setStackBase(branch, parentTip); err != nil {
+			return err
+		}
+		state.queue = state.queue[1:]
+	}
+
+	clearRestackState()
+	if current, _ := currentGitBranch(); current != state.original {
+		if err := runGitCommandStreaming(ctx, "checkout", "--quiet", state.original); err != nil {
+			return fmt.Errorf("git checkout %s: %w", state.original, err)
+		}
+	}
+	switch {
+	case resumed:
+		fmt.Fprintf(ctx.Stdout(), "✔️ Restack finished; push the branches with %s stack push\n", commandName)
+		return nil
+	case restacked == 0:
+		fmt.Fprintln(ctx.Stdout(), "✔️ Stack is up to date")
+		return nil
+	}
+	fmt.Fprintf(ctx.Stdout(), "✔️ Restacked %d branch(es); push them with %s stack push\n", restacked, commandName)
+	return nil
+}
+
+func rebaseInProgress() bool {
+	for _, dir := range []string{"rebase-merge", "rebase-apply"} {
+		path, err := gitOutput("rev-parse", "--git-path", dir)
+		if err != nil {
+			continue
+		}
+		if _, err := os.Stat(strings.TrimSpace(path)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func restackStatePath() (string, error) {
+	out, err := gitOutput("rev-parse", "--git-path", stackRestackFile)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// The state file holds the original branch on the first line and the
+// remaining queue on the lines after it.
+func loadRestackState() (restackState, error) {
+	path, err := restackStatePath()
+	if err != nil {
+		return restackState{}, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return restackState{}, fmt.Errorf("no restack in progress")
+		}
+		return restackState{}, err
+	}
+	lines := strings.Fields(string(data))
+	if len(lines) < 2 {
+		return restackState{}, fmt.Errorf("restack state in %s is corrupt; delete it and start again", path)
+	}
+	return restackState{original: lines[0], queue: lines[1:]}, nil
+}
+
+func saveRestackState(state restackState) error {
+	path, err := restackStatePath()
+	if err != nil {
+		return err
+	}
+	data := strings.Join(append([]string{state.original}, state.queue...), "\n") + "\n"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		return fmt.Errorf("save restack state: %w", err)
+	}
+	return nil
+}
+
+func clearRestackState() {
+	if path, err := restackStatePath(); err == nil {
+		_ = os.Remove(path)
+	}
+}
+
+// pushStack force-pushes every branch in the current stack with a lease, so
+// a branch someone else pushed to in the meantime is left alone.
+func pushStack(ctx *snap.Context, requestedRemote string) error {
+	current, err := currentGitBranch()
+	if err != nil {
+		return err
+	}
+	parents, err := loadStackParents()
+	if err != nil {
+		return err
+	}
+	branches := stackBranches(parents, current)
+	if len(branches) == 0 {
+		return fmt.Errorf("%s is not part of a stack; use %s stack new or %s stack track", current, commandName, commandName)
+	}
+
+	var failed []string
+	for _, branch := range branches {
+		if stackIsStale(branch, parents[branch]) {
+			fmt.Fprintf(ctx.Stderr(), "⚠️ %s needs a restack onto %s; pushing it as it is\n", branch, parents[branch])
+		}
+		remote, err := resolvePushRemote(branch, requestedRemote)
+		if err != nil {
+			return err
+		}
+		args := []string{"push", "--force-with-lease"}
+		if upstream := gitConfigValue("branch." + branch + ".remote"); upstream == "" || upstream == "." {
+			args = append(args, "--set-upstream")
+		}
+		args = append(args, remote, branch)
+		fmt.Fprintf(ctx.Stdout(), "ℹ️ Pushing %s to %s\n", branch, remote)
+		if err := runGitCommandStreaming(ctx, args...); err != nil {
+			fmt.Fprintf(ctx.Stderr(), "⚠️ git %s: %v\n", strings.Join(args, " "), err)
+			failed = append(failed, branch)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("could not push %s", strings.Join(failed, ", "))
+	}
+	fmt.Fprintf(ctx.Stdout(), "✔️ Pushed %d branch(es)\n", len(branches))
+	return nil
+}
@@ -0,0 +1,543 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/dzonerzy/go-snap/snap"
+)
+
+const syncForkStateFile = "FLOW_SYNC_FORK"
+
+// syncForkState is everything a sync paused on a conflict needs to resume.
+// Queue holds the branches still to sync, the conflicted one first.
+type syncForkState struct {
+	Remote   string           `json:"remote"`
+	Strategy string           `json:"strategy"`
+	Push     bool             `json:"push"`
+	Original string           `json:"original"`
+	Stash    string           `json:"stash,omitempty"`
+	Queue    []string         `json:"queue"`
+	Results  []syncForkResult `json:"results"`
+	// Before, From and To describe the conflicted branch: its tip before
+	// the sync and the upstream range being brought in.
+	Before string `json:"before,omitempty"`
+	From   string `json:"from,omitempty"`
+	To     string `json:"to,omitempty"`
+}
+
+type syncForkResult struct {
+	Branch string `json:"branch"`
+	Result string `json:"result"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+var errSyncForkPaused = errors.New("sync paused on a conflict")
+
+func runGitSyncFork(ctx *snap.Context) error {
+	usage := fmt.Sprintf("Usage: %s gitSyncFork [--branch <name> | --all-tracked] [--strategy rebase|merge] [--remote <remote>] [--autostash] [--push] | --continue | --abort", commandName)
+
+	if err := ensureGitRepository(); err != nil {
+		return err
+	}
+
+	var (
+		branch     string
+		strategy   = "rebase"
+		remote     = "upstream"
+		allTracked bool
+		autostash  bool
+		push       bool
+		mode       string
+	)
+
+	for i := 0; i < ctx.NArgs(); i++ {
+		arg := strings.TrimSpace(ctx.Arg(i))
+		if arg == "" {
+			continue
+		}
+
+		switch {
+		case arg == "--branch":
+			i++
+			if i >= ctx.NArgs() {
+				fmt.Fprintln(ctx.Stderr(), usage)
+				return fmt.Errorf("--branch requires a value")
+			}
+			branch = strings.TrimSpace(ctx.Arg(i))
+		case strings.HasPrefix(arg, "--branch="):
+			branch = strings.TrimSpace(strings.TrimPrefix(arg, "--branch="))
+		case arg == "--strategy":
+			i++
+			if i >= ctx.NArgs() {
+				fmt.Fprintln(ctx.Stderr(), usage)
+				return fmt.Errorf("--strategy requires a value")
+			}
+			strategy = strings.TrimSpace(ctx.Arg(i))
+		case strings.HasPrefix(arg, "--strategy="):
+			strategy = strings.TrimSpace(strings.TrimPrefix(arg, "--strategy="))
+		case arg == "--remote":
+			i++
+			if i >= ctx.NArgs() {
+				fmt.Fprintln(ctx.Stderr(), usage)
+				return fmt.Errorf("--remote requires a value")
+			}
+			remote = strings.TrimSpace(ctx.Arg(i))
+		case strings.HasPrefix(arg, "--remote="):
+			remote = strings.TrimSpace(strings.TrimPrefix(arg, "--remote="))
+		case arg == "--all-tracked":
+			allTracked = true
+		case arg == "--autostash":
+			autostash = true
+		case arg == "--push":
+			push = true
+		case (arg == "--continue" || arg == "--abort") && mode == "":
+			mode = arg
+		default:
+			fmt.Fprintln(ctx.Stderr(), usage)
+			return fmt.Errorf("unexpected argument %q", arg)
+		}
+	}
+
+	switch mode {
+	case "--continue":
+		if ctx.NArgs() > 1 {
+			fmt.Fprintln(ctx.Stderr(), usage)
+			return fmt.Errorf("--continue takes no other flags")
+		}
+		return reportError(ctx, continueSyncFork(ctx))
+	case "--abort":
+		if ctx.NArgs() > 1 {
+			fmt.Fprintln(ctx.Stderr(), usage)
+			return fmt.Errorf("--abort takes no other flags")
+		}
+		return reportError(ctx, abortSyncFork(ctx))
+	}
+
+	strategy = strings.ToLower(strategy)
+	if strategy == "" {
+		strategy = "rebase"
+	}
+	if strategy != "rebase" && strategy != "merge" {
+		fmt.Fprintln(ctx.Stderr(), usage)
+		return fmt.Errorf("unsupported strategy %q", strategy)
+	}
+	if allTracked && branch != "" {
+		fmt.Fprintln(ctx.Stderr(), usage)
+		return fmt.Errorf("--branch and --all-tracked cannot be combined")
+	}
+	if remote == "" {
+		return fmt.Errorf("remote cannot be empty")
+	}
+	// A state file that no longer parses still means a sync was cut short.
+	if syncForkStateExists() {
+		return reportError(ctx, fmt.Errorf("a gitSyncFork is already in progress; run %s gitSyncFork --continue or --abort", commandName))
+	}
+
+	exists, _, err := gitRemoteState(remote)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("git remote %q not found", remote)
+	}
+
+	if !allTracked {
+		if branch == "" {
+			branch = detectDefaultBranch()
+		}
+		if strings.TrimSpace(branch) == "" || branch == "HEAD" {
+			return fmt.Errorf("could not determine branch to sync; provide one with --branch")
+		}
+	}
+
+	original, err := currentGitBranch()
+	if err != nil {
+		return err
+	}
+	if original == "HEAD" {
+		// Come back to the same detached commit afterwards.
+		if original, err = resolveCommitSHA("HEAD"); err != nil {
+			return err
+		}
+	}
+
+	if err := runGitCommandStreaming(ctx, "fetch", remote, "--prune"); err != nil {
+		return fmt.Errorf("git fetch %s --prune: %w", remote, err)
+	}
+
+	var branches []string
+	if allTracked {
+		if branches, err = branchesOnRemote(remote); err != nil {
+			return reportError(ctx, err)
+		}
+		if len(branches) == 0 {
+			return reportError(ctx, fmt.Errorf("no local branches have a counterpart on %s", remote))
+		}
+	} else {
+		remoteRef := fmt.Sprintf("%s/%s", remote, branch)
+		hasRemoteBranch, err := gitRefExists(remoteRef)
+		if err != nil {
+			return fmt.Errorf("check remote branch %s: %w", remoteRef, err)
+		}
+		if !hasRemoteBranch {
+			return fmt.Errorf("remote branch %s not found", remoteRef)
+		}
+		branches = []string{branch}
+	}
+
+	st := syncForkState{Remote: remote, Strategy: strategy, Push: push, Original: original, Queue: branches}
+
+	status, err := gitOutput("status", "--porcelain", "--untracked-files=no")
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(status) != "" {
+		if !autostash {
+			return reportError(ctx, fmt.Errorf("you have uncommitted changes; commit or stash them, or rerun with --autostash"))
+		}
+		if err := runGitCommandStreaming(ctx, "stash", "push", "--quiet", "-m", "fgo gitSyncFork autostash"); err != nil {
+			return reportError(ctx, fmt.Errorf("git stash push: %w", err))
+		}
+		if st.Stash, err = resolveCommitSHA("stash@{0}"); err != nil {
+			return reportError(ctx, err)
+		}
+		fmt.Fprintf(ctx.Stdout(), "ℹ️ Stashed your changes as %s; they come back when the sync finishes\n", shortSHA(st.Stash))
+	}
+
+	return reportSyncForkPause(ctx, runSyncForkQueue(ctx, st))
+}
+
+// branchesOnRemote lists local branches that also exist on remote, the
+// default branch first.
+func branchesOnRemote(remote string) ([]string, error) {
+	out, err := gitOutput("for-each-ref", "--format=%(refname:short)", "refs/heads")
+	if err != nil {
+		return nil, err
+	}
+	defaultBranch := detectBaseBranch(remote)
+	var branches []string
+	for _, name := range strings.Fields(out) {
+		if ok, _ := gitRefExists("refs/remotes/" + remote + "/" + name); ok {
+			branches = append(branches, name)
+		}
+	}
+	sort.SliceStable(branches, func(i, j int) bool {
+		return branches[i] == defaultBranch && branches[j] != defaultBranch
+	})
+	return branches, nil
+}
+
+// runSyncForkQueue syncs the queued branches in turn. A conflict saves the
+// state and stops; any other failure is recorded and the next branch synced.
+func runSyncForkQueue(ctx *snap.Context, st syncForkState) error {
+	for len(st.Queue) > 0 {
+		branch := st.Queue[0]
+		result, err := syncForkBranch(ctx, &st, branch)
+		if errors.Is(err, errSyncForkPaused) {
+			if saveErr := saveSyncForkState(st); saveErr != nil {
+				return saveErr
+			}
+			return err
+		}
+		if err != nil {
+			fmt.Fprintf(ctx.Stderr(), "⚠️ %s: %v\n", branch, err)
+			result.Result = "failed"
+		}
+		st.Results = append(st.Results, finishSyncForkBranch(ctx, st, result))
+		st.Queue = st.Queue[1:]
+	}
+	return finishSyncFork(ctx, st)
+}
+
+// syncForkBranch checks out branch and rebases or merges it onto its
+// counterpart on the remote, creating it when it does not exist locally.
+func syncForkBranch(ctx *snap.Context, st *syncForkState, branch string) (syncForkResult, error) {
+	result := syncForkResult{Branch: branch}
+	remoteRef := fmt.Sprintf("%s/%s", st.Remote, branch)
+
+	localExists, err := gitRefExists("refs/heads/" + branch)
+	if err != nil {
+		return result, fmt.Errorf("check local branch %s: %w", branch, err)
+	}
+	if !localExists {
+		if err := runGitCommandStreaming(ctx, "checkout", "-b", branch, remoteRef); err != nil {
+			return result, fmt.Errorf("git checkout -b %s %s: %w", branch, remoteRef, err)
+		}
+		result.Result = "created"
+		result.After, _ = resolveCommitSHA("HEAD")
+		return result, nil
+	}
+
+	if current, _ := currentGitBranch(); current != branch {
+		if err := runGitCommandStreaming(ctx, "checkout", "--quiet", branch); err != nil {
+			return result, fmt.Errorf("git checkout %s: %w", branch, err)
+		}
+	}
+	if result.Before, err = resolveCommitSHA("HEAD"); err != nil {
+		return result, err
+	}
+	syncTo, err := resolveCommitSHA(remoteRef)
+	if err != nil {
+		return result, err
+	}
+	syncFrom := ""
+	if out, err := gitOutput("merge-base", branch, remoteRef); err == nil {
+		syncFrom = strings.TrimSpace(out)
+	}
+
+	if syncFrom == syncTo {
+		recordSyncRange(branch, syncFrom, syncTo)
+		result.Result = "up to date"
+		result.After = result.Before
+		return result, nil
+	}
+
+	var args []string
+	if st.Strategy == "merge" {
+		args = []string{"merge", "--no-ff", "--no-edit", remoteRef}
+	} else {
+		autoSnapshot(ctx, "gitSyncFork")
+		args = []string{"rebase", remoteRef}
+	}
+	if err := runGitCommandStreaming(ctx, args...); err != nil {
+		if rebaseInProgress() || mergeInProgress() {
+			st.Before, st.From, st.To = result.Before, syncFrom, syncTo
+			return result, errSyncForkPaused
+		}
+		return result, fmt.Errorf("git %s: %w", strings.Join(args, " "), err)
+	}
+
+	recordSyncRange(branch, syncFrom, syncTo)
+	result.Result = st.Strategy + "d"
+	result.After, _ = resolveCommitSHA("HEAD")
+	return result, nil
+}
+
+// finishSyncForkBranch pushes a synced branch to origin when --push was
+// given, noting the outcome in the result.
+func finishSyncForkBranch(ctx *snap.Context, st syncForkState, result syncForkResult) syncForkResult {
+	if !st.Push || result.Result == "failed" {
+		return result
+	}
+	// A rebase rewrites commits origin may already have.
+	opts := pushOptions{remote: "origin", forceWithLease: result.Result == "rebased"}
+	if err := pushCurrentBranch(ctx, opts); err != nil {
+		fmt.Fprintf(ctx.Stderr(), "⚠️ push %s: %v\n", result.Branch, err)
+		result.Result += ", push failed"
+		return result
+	}
+	result.Result += ", pushed"
+	return result
+}
+
+func continueSyncFork(ctx *snap.Context) error {
+	st, err := loadSyncForkState()
+	if err != nil {
+		return err
+	}
+
+	var args []string
+	switch {
+	case rebaseInProgress():
+		args = []string{"rebase", "--continue"}
+	case mergeInProgress():
+		args = []string{"commit", "--no-edit"}
+	}
+	if args != nil {
+		cmd := exec.Command("git", args...)
+		cmd.Env = append(os.Environ(), "GIT_EDITOR=true")
+		cmd.Stdout = ctx.Stdout()
+		cmd.Stderr = ctx.Stderr()
+		cmd.Stdin = ctx.Stdin()
+		if err := cmd.Run(); err != nil {
+			fmt.Fprintf(ctx.Stderr(), "Still conflicted; resolve it, git add the files and run %s gitSyncFork --continue.\n", commandName)
+			return fmt.Errorf("git %s: %w", strings.Join(args, " "), err)
+		}
+	}
+
+	branch := st.Queue[0]
+	recordSyncRange(branch, st.From, st.To)
+	result := syncForkResult{Branch: branch, Result: st.Strategy + "d", Before: st.Before}
+	result.After, _ = resolveCommitSHA("HEAD")
+	st.Results = append(st.Results, finishSyncForkBranch(ctx, st, result))
+	st.Queue = st.Queue[1:]
+	st.Before, st.From, st.To = "", "", ""
+	return reportSyncForkPause(ctx, runSyncForkQueue(ctx, st))
+}
+
+func abortSyncFork(ctx *snap.Context) error {
+	st, err := loadSyncForkState()
+	corrupt := err != nil && syncForkStateExists()
+	if err != nil && !corrupt {
+		return err
+	}
+	switch {
+	case rebaseInProgress():
+		if err := runGitCommandStreaming(ctx, "rebase", "--abort"); err != nil {
+			return fmt.Errorf("git rebase --abort: %w", err)
+		}
+	case mergeInProgress():
+		if err := runGitCommandStreaming(ctx, "merge", "--abort"); err != nil {
+			return fmt.Errorf("git merge --abort: %w", err)
+		}
+	}
+	if corrupt {
+		clearSyncForkState()
+		fmt.Fprintln(ctx.Stderr(), "⚠️ Discarded the unreadable sync state; the original branch and any autostash were not restored (see git stash list)")
+		return nil
+	}
+
+	st.Results = append(st.Results, syncForkResult{Branch: st.Queue[0], Result: "aborted", Before: st.Before, After: st.Before})
+	for _, branch := range st.Queue[1:] {
+		st.Results = append(st.Results, syncForkResult{Branch: branch, Result: "skipped"})
+	}
+	st.Queue = nil
+	return finishSyncFork(ctx, st)
+}
+
+// finishSyncFork returns to the branch the sync started on, brings back
+// stashed changes and prints what happened to each branch.
+func finishSyncFork(ctx *snap.Context, st syncForkState) error {
+	clearSyncForkState()
+
+	if current, _ := currentGitBranch(); current != st.Original {
+		if err := runGitCommandStreaming(ctx, "checkout", "--quiet", st.Original); err != nil {
+			fmt.Fprintf(ctx.Stderr(), "⚠️ Could not return to %s: %v\n", st.Original, err)
+		}
+	}
+	if st.Stash != "" {
+		restoreSyncForkStash(ctx, st.Stash)
+	}
+
+	fmt.Fprintln(ctx.Stdout())
+	w := tabwriter.NewWriter(ctx.Stdout(), 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Branch\tResult\tBefore\tAfter")
+	failed := 0
+	for _, r := range st.Results {
+		before, after := "-", "-"
+		if r.Before != "" {
+			before = shortSHA(r.Before)
+		}
+		if r.After != "" {
+			after = shortSHA(r.After)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.Branch, r.Result, before, after)
+		if strings.HasPrefix(r.Result, "failed") || strings.HasSuffix(r.Result, "push failed") {
+			failed++
+		}
+	}
+	_ = w.Flush()
+
+	if len(st.Results) == 1 {
+		r := st.Results[0]
+		if r.Before != "" && r.Before != r.After && r.Result != "aborted" {
+			fmt.Fprintf(ctx.Stdout(), "ℹ️ Run %s explain --upstream for a summary of what changed upstream\n", commandName)
+		}
+		if !st.Push && r.Result != "failed" && r.Result != "aborted" {
+			fmt.Fprintf(ctx.Stdout(), "Next: git push origin %s\n", r.Branch)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d branch(es) did not sync cleanly", failed)
+	}
+	return nil
+}
+
+func restoreSyncForkStash(ctx *snap.Context, sha string) {
+	out, err := gitOutput("stash", "list", "--format=%H")
+	if err != nil {
+		fmt.Fprintf(ctx.Stderr(), "⚠️ Could not restore your stashed changes (%s): %v\n", shortSHA(sha), err)
+		return
+	}
+	for i, entry := range strings.Fields(out) {
+		if entry != sha {
+			continue
+		}
+		ref := fmt.Sprintf("stash@{%d}", i)
+		if err := runGitCommandStreaming(ctx, "stash", "pop", "--quiet", ref); err != nil {
+			fmt.Fprintf(ctx.Stderr(), "⚠️ Your changes did not apply cleanly; they are still in %s\n", ref)
+			return
+		}
+		fmt.Fprintln(ctx.Stdout(), "✔️ Restored your stashed changes")
+		return
+	}
+	fmt.Fprintf(ctx.Stderr(), "⚠️ Stash %s is gone; apply it with git stash apply %s if you still need it\n", shortSHA(sha), sha)
+}
+
+// reportSyncForkPause explains how to resume when err is a paused sync.
+func reportSyncForkPause(ctx *snap.Context, err error) error {
+	if errors.Is(err, errSyncForkPaused) {
+		fmt.Fprintf(ctx.Stderr(), "Sync stopped on a conflict; resolve it, git add the files and run %s gitSyncFork --continue (or --abort).\n", commandName)
+		return err
+	}
+	return reportError(ctx, err)
+}
+
+func mergeInProgress() bool {
+	return exec.Command("git", "rev-parse", "--quiet", "--verify", "MERGE_HEAD").Run() == nil
+}
+
+func syncForkStatePath() (string, error) {
+	out, err := gitOutput("rev-parse", "--git-path", syncForkStateFile)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+func loadSyncForkState() (syncForkState, error) {
+	path, err := syncForkStatePath()
+	if err != nil {
+		return syncForkState{}, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return syncForkState{}, fmt.Errorf("no gitSyncFork in progress")
+		}
+		return syncForkState{}, err
+	}
+	var st syncForkState
+	if err := json.Unmarshal(data, &st); err != nil || len(st.Queue) == 0 {
+		return syncForkState{}, fmt.Errorf("sync state in %s is corrupt; run %s gitSyncFork --abort to discard it", path, commandName)
+	}
+	return st, nil
+}
+
+func saveSyncForkState(st syncForkState) error {
+	path, err := syncForkStatePath()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("save sync state: %w", err)
+	}
+	return nil
+}
+
+func syncForkStateExists() bool {
+	path, err := syncForkStatePath()
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(path)
+	return err == nil
+}
+
+func clearSyncForkState() {
+	if path, err := syncForkStatePath(); err == nil {
+		_ = os.Remove(path)
+	}
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/dzonerzy/go-snap/snap"
+)
+
+const (
+	// defaultTicketPattern matches the leading ticket id of the last branch
+	// segment, e.g. nikiv/ABC-123-login, or its leading number as
+	// branchFromClipboard requires, e.g. nikiv/123-login for #123. Numbers
+	// later in the segment, like fix-v2, are not taken for tickets.
+	defaultTicketPattern = `^([A-Za-z][A-Za-z0-9]*-[0-9]+|[0-9]+)(?:[-_.]|$)`
+	pairSessionTTL       = 12 * time.Hour
+)
+
+type pairSession struct {
+	Started   time.Time `json:"started"`
+	CoAuthors []string  `json:"co_authors"`
+}
+
+// commitTrailers returns the trailers fgo adds to new commits: a ticket
+// reference from the branch name, co-authors from the pairing session and a
+// sign-off when the repository asks for one.
+func commitTrailers() []string {
+	var trailers []string
+
+	if branch, err := currentGitBranch(); err == nil {
+		if ticket := ticketFromBranch(branch); ticket != "" {
+			key := strings.TrimSpace(gitConfigValue("flow.ticketTrailer"))
+			if key == "" {
+				key = "Refs"
+			}
+			trailers = append(trailers, key+": "+ticket)
+		}
+	}
+
+	self := committerIdentity()
+	if session, err := loadPairSession(); err == nil && session != nil {
+		for _, coAuthor := range session.CoAuthors {
+			if self != "" && strings.EqualFold(identityEmail(coAuthor), identityEmail(self)) {
+				continue
+			}
+			trailers = append(trailers, "Co-authored-by: "+coAuthor)
+		}
+	}
+
+	if self != "" && repoRequiresSignoff() {
+		trailers = append(trailers, "Signed-off-by: "+self)
+	}
+
+	return trailers
+}
+
+func ticketFromBranch(branch string) string {
+	pattern := strings.TrimSpace(gitConfigValue("flow.ticketPattern"))
+	subject := branch
+	if pattern == "" {
+		pattern = defaultTicketPattern
+		subject = branch[strings.LastIndex(branch, "/")+1:]
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️ Ignoring invalid flow.ticketPattern %q: %v\n", pattern, err)
+		return ""
+	}
+
+	match := re.FindStringSubmatch(subject)
+	if match == nil {
+		return ""
+	}
+	ticket := match[0]
+	if len(match) > 1 && match[1] != "" {
+		ticket = match[1]
+	}
+
+	ticket = strings.ToUpper(strings.Trim(ticket, "-_./"))
+	if ticket == "" {
+		return ""
+	}
+	if strings.Trim(ticket, "0123456789") == "" {
+		return "#" + ticket
+	}
+	return ticket
+}
+
+// repoRequiresSignoff reports whether commits need a DCO sign-off. An
+// explicit flow.signoff setting wins; otherwise it looks for the usual DCO
+// markers in the repository.
+func repoRequiresSignoff() bool {
+	switch strings.ToLower(strings.TrimSpace(gitConfigValue("flow.signoff"))) {
+	case "true", "yes", "on", "1":
+		return true
+	case "false", "no", "off", "0":
+		return false
+	}
+
+	root, err := gitOutput("rev-parse", "--show-toplevel")
+	if err != nil {
+		return false
+	}
+	root = strings.TrimSpace(root)
+
+	for _, name := range []string{"DCO", "DCO.md", "DCO.txt", ".github/dco.yml", ".github/DCO"} {
+		if _, err := os.Stat(filepath.Join(root, name)); err == nil {
+			return true
+		}
+	}
+	for _, name := range []string{"CONTRIBUTING.md", "CONTRIBUTING", ".github/CONTRIBUTING.md", "docs/CONTRIBUTING.md"} {
+		data, err := os.ReadFile(filepath.Join(root, name))
+		if err != nil {
+			continue
+		}
+		text := string(data)
+		if strings.Contains(text, "Signed-off-by") || strings.Contains(text, "Developer Certificate of Origin") {
+			return true
+		}
+	}
+	return false
+}
+
+// appendCommitTrailers adds trailers to message using git interpret-trailers,
+// so existing trailer blocks are extended rather than duplicated.
+func appendCommitTrailers(message string, trailers []string) (string, error) {
+	if len(trailers) == 0 {
+		return message, nil
+	}
+
+	args := []string{"interpret-trailers", "--if-exists", "addIfDifferent"}
+	for _, trailer := range trailers {
+		args = append(args, "--trailer", trailer)
+	}
+
+	cmd := exec.Command("git", args...)
+	cmd.Stdin = strings.NewReader(strings.TrimSpace(message) + "\n")
+	out, err := cmd.Output()
+	if err != nil {
+		return message, fmt.Errorf("git interpret-trailers: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// parseCommitTrailers returns the trailer lines of an existing message.
+func parseCommitTrailers(message string) []string {
+	cmd := exec.Command("git", "interpret-trailers", "--parse")
+	cmd.Stdin = strings.NewReader(message)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil
+	}
+
+	var trailers []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			trailers = append(trailers, line)
+		}
+	}
+	return trailers
+}
+
+func (p *commitPayload) applyTrailers(ctx *snap.Context, trailers []string) {
+	message, err := appendCommitTrailers(p.message, trailers)
+	if err != nil {
+		fmt.Fprintf(ctx.Stderr(), "⚠️ Skipping commit trailers: %v\n", err)
+		return
+	}
+	if err := p.setMessage(message); err != nil {
+		fmt.Fprintf(ctx.Stderr(), "⚠️ Skipping commit trailers: %v\n", err)
+	}
+}
+
+func gitConfigValue(key string) string {
+	out, err := exec.Command("git", "config", "--get", key).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func committerIdentity() string {
+	out, err := exec.Command("git", "var", "GIT_COMMITTER_IDENT").Output()
+	if err != nil {
+		return ""
+	}
+	ident := strings.TrimSpace(string(out))
+	if end := strings.LastIndex(ident, ">"); end >= 0 {
+		return ident[:end+1]
+	}
+	return ""
+}
+
+func identityEmail(identity string) string {
+	start := strings.LastIndex(identity, "<")
+	end := strings.LastIndex(identity, ">")
+	if start < 0 || end <= start {
+		return ""
+	}
+	return identity[start+1 : end]
+}
+
+func pairSessionPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("determine home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".flow", "pair.json"), nil
+}
+
+func loadPairSession() (*pairSession, error) {
+	path, err := pairSessionPath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var session pairSession
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if time.Since(session.Started) > pairSessionTTL || len(session.CoAuthors) == 0 {
+		return nil, nil
+	}
+	return &session, nil
+}
+
+func savePairSession(session *pairSession) error {
+	path, err := pairSessionPath()
+	if err != nil {
+		return err
+	}
+	if session == nil {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("remove %s: %w", path, err)
+		}
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("create directory %s: %w", filepath.Dir(path), err)
+	}
+	data, err := json.MarshalIndent(session, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	return nil
+}
+
+// resolvePairAlias turns an alias into "Name <email>". It accepts a literal
+// identity, a flow.pair.<alias> git config entry, or a unique match against
+// the authors in the repository history.
+func resolvePairAlias(alias string) (string, error) {
+	if strings.Contains(alias, "<") && strings.HasSuffix(alias, ">") {
+		return alias, nil
+	}
+	if configured := gitConfigValue("flow.pair." + alias); configured != "" {
+		return configured, nil
+	}
+
+	out, err := exec.Command("git", "log", "--format=%an <%ae>", "-n", "2000").Output()
+	if err != nil {
+		return "", fmt.Errorf("unknown pair alias %q; set it with git config --global flow.pair.%s \"Name <email>\"", alias, alias)
+	}
+
+	needle := strings.ToLower(alias)
+	seen := make(map[string]struct{})
+	var matches []string
+	for _, line := range strings.Split(string(out), "\n") {
+		identity := strings.TrimSpace(line)
+		if identity == "" {
+			continue
+		}
+		email := strings.ToLower(identityEmail(identity))
+		local, _, _ := strings.Cut(email, "@")
+		name := strings.ToLower(strings.TrimSpace(identity[:strings.LastIndex(identity, "<")]))
+		if local != needle && email != needle && name != needle && !strings.HasPrefix(name, needle+" ") {
+			continue
+		}
+		if _, ok := seen[email]; ok {
+			continue
+		}
+		seen[email] = struct{}{}
+		matches = append(matches, identity)
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("unknown pair alias %q; set it with git config --global flow.pair.%s \"Name <email>\"", alias, alias)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("pair alias %q is ambiguous (%s); set flow.pair.%s", alias, strings.Join(matches, ", "), alias)
+	}
+}
+
+func runPair(ctx *snap.Context) error {
+	usage := fmt.Sprintf("Usage: %s pair [<alias>...] [--clear]", commandName)
+
+	var (
+		aliases      []string
+		clearSession bool
+	)
+	for i := 0; i < ctx.NArgs(); i++ {
+		arg := strings.TrimSpace(ctx.Arg(i))
+		if arg == "" {
+			continue
+		}
+		switch {
+		case arg == "--clear" || arg == "off":
+			clearSession = true
+		case strings.HasPrefix(arg, "--"):
+			fmt.Fprintln(ctx.Stderr(), usage)
+			return fmt.Errorf("unknown flag %q", arg)
+		default:
+			aliases = append(aliases, arg)
+		}
+	}
+
+	if clearSession {
+		if len(aliases) > 0 {
+			fmt.Fprintln(ctx.Stderr(), usage)
+			return fmt.Errorf("--clear does not take aliases")
+		}
+		if err := savePairSession(nil); err != nil {
+			return reportError(ctx, err)
+		}
+		fmt.Fprintln(ctx.Stdout(), "✔️ Pairing session cleared")
+		return nil
+	}
+
+	if len(aliases) == 0 {
+		session, err := loadPairSession()
+		if err != nil {
+			return reportError(ctx, err)
+		}
+		if session == nil {
+			fmt.Fprintln(ctx.Stdout(), "ℹ️ No active pairing session")
+			return nil
+		}
+		fmt.Fprintf(ctx.Stdout(), "Pairing since %s (expires %s):\n", session.Started.Local().Format("15:04"), session.Started.Add(pairSessionTTL).Local().Format("Jan 2 15:04"))
+		for _, coAuthor := range session.CoAuthors {
+			fmt.Fprintf(ctx.Stdout(), "  Co-authored-by: %s\n", coAuthor)
+		}
+		return nil
+	}
+
+	session := &pairSession{Started: time.Now()}
+	for _, alias := range aliases {
+		identity, err := resolvePairAlias(alias)
+		if err != nil {
+			return reportError(ctx, err)
+		}
+		session.CoAuthors = append(session.CoAuthors, identity)
+	}
+	if err := savePairSession(session); err != nil {
+		return reportError(ctx, err)
+	}
+
+	fmt.Fprintf(ctx.Stdout(), "✔️ Pairing with %s for the next %.0fh\n", strings.Join(session.CoAuthors, ", "), pairSessionTTL.Hours())
+	return nil
+}
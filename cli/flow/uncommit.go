@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/dzonerzy/go-snap/snap"
+)
+
+const (
+	flowCommitsFile = "FLOW_COMMITS"
+	// maxFlowCommitRecords bounds the record of commits fgo created.
+	maxFlowCommitRecords = 200
+)
+
+func runUncommit(ctx *snap.Context) error {
+	usage := fmt.Sprintf("Usage: %s uncommit [--yes]", commandName)
+
+	assumeYes := false
+	for i := 0; i < ctx.NArgs(); i++ {
+		arg := strings.TrimSpace(ctx.Arg(i))
+		switch arg {
+		case "":
+		case "--yes", "-y":
+			assumeYes = true
+		default:
+			fmt.Fprintln(ctx.Stderr(), usage)
+			return fmt.Errorf("unexpected argument %q", arg)
+		}
+	}
+
+	if err := ensureGitRepository(); err != nil {
+		return reportError(ctx, err)
+	}
+
+	head, err := resolveCommitSHA("HEAD")
+	if err != nil {
+		return reportError(ctx, err)
+	}
+	if !isFlowCommit(head) {
+		return reportError(ctx, fmt.Errorf("HEAD (%s) was not created by %s; use git reset --soft HEAD~1 if you really want to undo it", shortSHA(head), commandName))
+	}
+	if exists, err := gitRefExists("HEAD~1"); err != nil {
+		return reportError(ctx, err)
+	} else if !exists {
+		return reportError(ctx, fmt.Errorf("HEAD (%s) is the root commit; there is nothing to reset to", shortSHA(head)))
+	}
+
+	subject, err := gitOutput("log", "-1", "--format=%s", head)
+	if err != nil {
+		return reportError(ctx, err)
+	}
+	subject = strings.TrimSpace(subject)
+
+	remotes, err := remoteBranchesContaining(head)
+	if err != nil {
+		return reportError(ctx, err)
+	}
+	if len(remotes) > 0 {
+		return revertPushedCommit(ctx, head, subject, remotes, assumeYes)
+	}
+
+	if err := exec.Command("git", "diff", "--cached", "--quiet").Run(); err != nil {
+		return reportError(ctx, fmt.Errorf("the index has changes staged since %s; commit or unstage them first so the commit's changes can be restored exactly", shortSHA(head)))
+	}
+
+	message, err := gitOutput("log", "-1", "--format=%B", head)
+	if err != nil {
+		return reportError(ctx, err)
+	}
+
+	if !assumeYes {
+		fmt.Fprintf(ctx.Stdout(), "Undo %s %s and keep its changes staged? [y/n]: ", shortSHA(head), subject)
+		choice, err := readConfirmationChoice(ctx)
+		fmt.Fprintln(ctx.Stdout())
+		if err != nil {
+			return reportError(ctx, fmt.Errorf("reading choice: %w", err))
+		}
+		if strings.ToLower(string(choice)) != "y" {
+			fmt.Fprintln(ctx.Stdout(), "Uncommit cancelled.")
+			return nil
+		}
+	}
+
+	autoSnapshot(ctx, "uncommit")
+
+	// With nothing else staged, a soft reset leaves the index exactly as it
+	// was when the commit was made.
+	if err := runGitCommandStreaming(ctx, "reset", "--soft", "HEAD~1"); err != nil {
+		return reportError(ctx, fmt.Errorf("git reset --soft HEAD~1: %w", err))
+	}
+	forgetFlowCommit(head)
+	saveCommitResume(ctx, message)
+
+	fmt.Fprintf(ctx.Stdout(), "✔️ Uncommitted %s %s; its changes are staged again\n", shortSHA(head), subject)
+	if err := runGitCommandStreaming(ctx, "status", "--short"); err != nil {
+		fmt.Fprintf(ctx.Stderr(), "git status --short: %v\n", err)
+	}
+	fmt.Fprintf(ctx.Stdout(), "ℹ️ Unstage files with git restore --staged <path>, then run %s commit --resume to reuse the message\n", commandName)
+	return nil
+}
+
+// revertPushedCommit offers a revert commit for a commit others may already
+// have, instead of rewriting published history.
+func revertPushedCommit(ctx *snap.Context, sha, subject string, remotes []string, assumeYes bool) error {
+	fmt.Fprintf(ctx.Stdout(), "%s %s is already on %s; resetting it would rewrite published history.\n", shortSHA(sha), subject, strings.Join(remotes, ", "))
+	if !assumeYes {
+		fmt.Fprint(ctx.Stdout(), "Create a revert commit instead? [y/n]: ")
+		choice, err := readConfirmationChoice(ctx)
+		fmt.Fprintln(ctx.Stdout())
+		if err != nil {
+			return reportError(ctx, fmt.Errorf("reading choice: %w", err))
+		}
+		if strings.ToLower(string(choice)) != "y" {
+			fmt.Fprintln(ctx.Stdout(), "Uncommit cancelled.")
+			return nil
+		}
+	}
+
+	if err := runGitCommandStreaming(ctx, "revert", "--no-edit", sha); err != nil {
+		return reportError(ctx, fmt.Errorf("git revert %s: %w", shortSHA(sha), err))
+	}
+	fmt.Fprintf(ctx.Stdout(), "✔️ Reverted %s; push the revert with %s commitPush or git push\n", shortSHA(sha), commandName)
+	return nil
+}
+
+func flowCommitsPath() (string, error) {
+	out, err := gitOutput("rev-parse", "--git-path", flowCommitsFile)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+func loadFlowCommits() []string {
+	path, err := flowCommitsPath()
+	if err != nil {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	return strings.Fields(string(data))
+}
+
+func saveFlowCommits(shas []string) {
+	path, err := flowCommitsPath()
+	if err != nil {
+		return
+	}
+	if len(shas) > maxFlowCommitRecords {
+		shas = shas[len(shas)-maxFlowCommitRecords:]
+	}
+	if len(shas) == 0 {
+		_ = os.Remove(path)
+		return
+	}
+	_ = os.WriteFile(path, []byte(strings.Join(shas, "\n")+"\n"), 0o644)
+}
+
+// recordFlowCommit remembers that fgo created the current HEAD, so uncommit
+// only ever undoes commits made through it.
+func recordFlowCommit() {
+	head, err := resolveCommitSHA("HEAD")
+	if err != nil {
+		return
+	}
+	saveFlowCommits(append(loadFlowCommits(), head))
+}
+
+func isFlowCommit(sha string) bool {
+	for _, recorded := range loadFlowCommits() {
+		if recorded == sha {
+			return true
+		}
+	}
+	return false
+}
+
+func forgetFlowCommit(sha string) {
+	var kept []string
+	for _, recorded := range loadFlowCommits() {
+		if recorded != sha {
+			kept = append(kept, recorded)
+		}
+	}
+	saveFlowCommits(kept)
+}
+
+// remapFlowCommits carries the records over a history rewrite, where before
+// and after list the same commits in the same order. When the lists do not
+// line up, records of the rewritten commits are dropped instead, so uncommit
+// never trusts a SHA that is no longer on the branch.
+func remapFlowCommits(before, after []string) {
+	recorded := loadFlowCommits()
+	if len(recorded) == 0 {
+		return
+	}
+	rewritten := make(map[string]string, len(before))
+	for i, sha := range before {
+		rewritten[sha] = ""
+		if len(before) == len(after) {
+			rewritten[sha] = after[i]
+		}
+	}
+	var kept []string
+	for _, sha := range recorded {
+		if replacement, ok := rewritten[sha]; ok {
+			sha = replacement
+		}
+		if sha != "" {
+			kept = append(kept, sha)
+		}
+	}
+	saveFlowCommits(kept)
+}
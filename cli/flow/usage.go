@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dzonerzy/go-snap/snap"
+)
+
+const monthlyBudgetEnv = "FLOW_AI_MONTHLY_BUDGET_USD"
+
+// defaultModelPrices are USD per million tokens; override them in
+// ~/.flow/usage/config.json.
+var defaultModelPrices = map[string]modelPrice{
+	"gpt-5-nano": {InputPerMillion: 0.05, OutputPerMillion: 0.40},
+	"gpt-5-mini": {InputPerMillion: 0.25, OutputPerMillion: 2.00},
+	"gpt-5":      {InputPerMillion: 1.25, OutputPerMillion: 10.00},
+}
+
+var activeCommandName string
+
+type usageRecord struct {
+	Time             time.Time `json:"time"`
+	Command          string    `json:"command"`
+	Repo             string    `json:"repo"`
+	Model            string    `json:"model"`
+	PromptTokens     int64     `json:"prompt_tokens"`
+	CompletionTokens int64     `json:"completion_tokens"`
+	LatencyMS        int64     `json:"latency_ms"`
+	Error            string    `json:"error,omitempty"`
+}
+
+type modelPrice struct {
+	InputPerMillion  float64 `json:"input_per_million"`
+	OutputPerMillion float64 `json:"output_per_million"`
+}
+
+type usageConfig struct {
+	MonthlyBudgetUSD float64               `json:"monthly_budget_usd"`
+	Prices           map[string]modelPrice `json:"prices"`
+}
+
+func usageDir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("determine home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".flow", "usage"), nil
+}
+
+func loadUsageConfig() usageConfig {
+	config := usageConfig{Prices: make(map[string]modelPrice)}
+	for model, price := range defaultModelPrices {
+		config.Prices[model] = price
+	}
+
+	if dir, err := usageDir(); err == nil {
+		if data, err := os.ReadFile(filepath.Join(dir, "config.json")); err == nil {
+			var fromFile usageConfig
+			if err := json.Unmarshal(data, &fromFile); err == nil {
+				config.MonthlyBudgetUSD = fromFile.MonthlyBudgetUSD
+				for model, price := range fromFile.Prices {
+					config.Prices[model] = price
+				}
+			}
+		}
+	}
+
+	if raw, ok := lookupNonEmptyEnv(monthlyBudgetEnv); ok {
+		if budget, err := strconv.ParseFloat(raw, 64); err == nil {
+			config.MonthlyBudgetUSD = budget
+		}
+	}
+
+	return config
+}
+
+func (c usageConfig) cost(record usageRecord) (float64, bool) {
+	price, ok := c.Prices[record.Model]
+	if !ok {
+		return 0, false
+	}
+	return float64(record.PromptTokens)/1e6*price.InputPerMillion + float64(record.CompletionTokens)/1e6*price.OutputPerMillion, true
+}
+
+func recordModelUsage(record usageRecord) {
+	dir, err := usageDir()
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return
+	}
+
+	if record.Command == "" {
+		record.Command = activeCommandName
+	}
+	if record.Repo == "" {
+		if root, err := gitOutput("rev-parse", "--show-toplevel"); err == nil {
+			record.Repo = strings.TrimSpace(root)
+		}
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+
+	file, err := os.OpenFile(filepath.Join(dir, "ledger.jsonl"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	_, _ = file.Write(append(line, '\n'))
+}
+
+func readUsageLedger() ([]usageRecord, error) {
+	dir, err := usageDir()
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(filepath.Join(dir, "ledger.jsonl"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []usageRecord
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var record usageRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err == nil {
+			records = append(records, record)
+		}
+	}
+	return records, scanner.Err()
+}
+
+func startOfMonth(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+}
+
+// warnIfOverBudget prints a warning before a model call when this month's
+// estimated spend has reached the configured budget.
+func warnIfOverBudget() {
+	config := loadUsageConfig()
+	if config.MonthlyBudgetUSD <= 0 {
+		return
+	}
+
+	records, err := readUsageLedger()
+	if err != nil {
+		return
+	}
+
+	since := startOfMonth(time.Now())
+	spent := 0.0
+	for _, record := range records {
+		if record.Time.Before(since) {
+			continue
+		}
+		if cost, ok := config.cost(record); ok {
+			spent += cost
+		}
+	}
+
+	switch {
+	case spent >= config.MonthlyBudgetUSD:
+		fmt.Fprintf(os.Stderr, "⚠️ AI spend this month is $%.4f, over the $%.2f budget\n", spent, config.MonthlyBudgetUSD)
+	case spent >= config.MonthlyBudgetUSD*0.8:
+		fmt.Fprintf(os.Stderr, "⚠️ AI spend this month is $%.4f, %.0f%% of the $%.2f budget\n", spent, spent/config.MonthlyBudgetUSD*100, config.MonthlyBudgetUSD)
+	}
+}
+
+type usageTotals struct {
+	calls            int
+	promptTokens     int64
+	completionTokens int64
+	cost             float64
+	unpriced         bool
+}
+
+func (t *usageTotals) add(config usageConfig, record usageRecord) {
+	t.calls++
+	t.promptTokens += record.PromptTokens
+	t.completionTokens += record.CompletionTokens
+	if cost, ok := config.cost(record); ok {
+		t.cost += cost
+	} else {
+		t.unpriced = true
+	}
+}
+
+func runUsage(ctx *snap.Context) error {
+	usage := fmt.Sprintf("Usage: %s usage [--days <n>]", commandName)
+
+	days := 0
+	for i := 0; i < ctx.NArgs(); i++ {
+		arg := strings.TrimSpace(ctx.Arg(i))
+		if arg == "" {
+			continue
+		}
+
+		var raw string
+		switch {
+		case arg == "--days":
+			i++
+			if i >= ctx.NArgs() {
+				fmt.Fprintln(ctx.Stderr(), usage)
+				return fmt.Errorf("--days requires a value")
+			}
+			raw = ctx.Arg(i)
+		case strings.HasPrefix(arg, "--days="):
+			raw = strings.TrimPrefix(arg, "--days=")
+		default:
+			fmt.Fprintln(ctx.Stderr(), usage)
+			return fmt.Errorf("unexpected argument %q", arg)
+		}
+
+		n, err := strconv.Atoi(strings.TrimSpace(raw))
+		if err != nil || n <= 0 {
+			fmt.Fprintln(ctx.Stderr(), usage)
+			return fmt.Errorf("--days expects a positive number, got %q", raw)
+		}
+		days = n
+	}
+
+	records, err := readUsageLedger()
+	if err != nil {
+		return reportError(ctx, fmt.Errorf("read usage ledger: %w", err))
+	}
+
+	now := time.Now()
+	since := startOfMonth(now)
+	period := now.Format("January 2006")
+	if days > 0 {
+		since = now.AddDate(0, 0, -days)
+		period = fmt.Sprintf("last %d days", days)
+	}
+
+	config := loadUsageConfig()
+	var (
+		total   usageTotals
+		byDay   = make(map[string]*usageTotals)
+		byRepo  = make(map[string]*usageTotals)
+		byModel = make(map[string]*usageTotals)
+	)
+	bucket := func(m map[string]*usageTotals, key string) *usageTotals {
+		if key == "" {
+			key = "(none)"
+		}
+		if m[key] == nil {
+			m[key] = &usageTotals{}
+		}
+		return m[key]
+	}
+
+	for _, record := range records {
+		if record.Time.Before(since) {
+			continue
+		}
+		total.add(config, record)
+		bucket(byDay, record.Time.Local().Format("2006-01-02")).add(config, record)
+		bucket(byRepo, record.Repo).add(config, record)
+		bucket(byModel, record.Model).add(config, record)
+	}
+
+	fmt.Fprintf(ctx.Stdout(), "AI usage for %s\n\n", period)
+	if total.calls == 0 {
+		fmt.Fprintln(ctx.Stdout(), "No model calls recorded.")
+		return nil
+	}
+
+	printUsageTable(ctx, "Day", byDay, false)
+	printUsageTable(ctx, "Repo", byRepo, true)
+	printUsageTable(ctx, "Model", byModel, true)
+
+	fmt.Fprintf(ctx.Stdout(), "Total: %d calls, %d prompt + %d completion tokens, %s\n", total.calls, total.promptTokens, total.completionTokens, formatUsageCost(total))
+	if config.MonthlyBudgetUSD > 0 && days == 0 {
+		fmt.Fprintf(ctx.Stdout(), "Budget: $%.4f of $%.2f (%.0f%%)\n", total.cost, config.MonthlyBudgetUSD, total.cost/config.MonthlyBudgetUSD*100)
+	}
+	return nil
+}
+
+func printUsageTable(ctx *snap.Context, label string, rows map[string]*usageTotals, byCost bool) {
+	keys := make([]string, 0, len(rows))
+	for key := range rows {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if byCost && rows[keys[i]].cost != rows[keys[j]].cost {
+			return rows[keys[i]].cost > rows[keys[j]].cost
+		}
+		return keys[i] < keys[j]
+	})
+
+	w := tabwriter.NewWriter(ctx.Stdout(), 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "%s\tCalls\tPrompt\tCompletion\tCost\n", label)
+	for _, key := range keys {
+		row := rows[key]
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%s\n", key, row.calls, row.promptTokens, row.completionTokens, formatUsageCost(*row))
+	}
+	_ = w.Flush()
+	fmt.Fprintln(ctx.Stdout())
+}
+
+func formatUsageCost(t usageTotals) string {
+	formatted := fmt.Sprintf("$%.4f", t.cost)
+	if t.unpriced {
+		formatted += " (some models unpriced)"
+	}
+	return formatted
+}
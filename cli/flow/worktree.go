@@ -0,0 +1,428 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/dzonerzy/go-snap/snap"
+	"github.com/ktr0731/go-fuzzyfinder"
+)
+
+// checkoutOptions controls how gitCheckout switches to a branch.
+type checkoutOptions struct {
+	worktree bool
+	open     bool
+}
+
+type gitWorktree struct {
+	path     string
+	head     string
+	branch   string
+	main     bool
+	prunable bool
+}
+
+// switchToBranch checks out local, creating it to track startPoint when
+// startPoint is set. In worktree mode the branch goes into its own directory
+// next to the repository instead of replacing the current checkout.
+func switchToBranch(ctx *snap.Context, local, startPoint string, opts checkoutOptions) error {
+	if !opts.worktree {
+		if startPoint == "" {
+			return runGitCommandStreaming(ctx, "checkout", local)
+		}
+		return runGitCommandStreaming(ctx, "checkout", "-b", local, "--track", startPoint)
+	}
+
+	worktrees, err := listWorktrees()
+	if err != nil {
+		return err
+	}
+	for _, wt := range worktrees {
+		if wt.branch == local {
+			fmt.Fprintf(ctx.Stdout(), "ℹ️ %s is already checked out in %s\n", local, wt.path)
+			return finishWorktree(ctx, wt.path, opts)
+		}
+	}
+
+	dir, err := worktreeDir(worktrees, local)
+	if err != nil {
+		return err
+	}
+	args := []string{"worktree", "add"}
+	if startPoint == "" {
+		args = append(args, dir, local)
+	} else {
+		args = append(args, "--track", "-b", local, dir, startPoint)
+	}
+	if err := runGitCommandStreaming(ctx, args...); err != nil {
+		return fmt.Errorf("git worktree add %s: %w", dir, err)
+	}
+	fmt.Fprintf(ctx.Stdout(), "✔️ Checked out %s in %s\n", local, dir)
+	return finishWorktree(ctx, dir, opts)
+}
+
+func finishWorktree(ctx *snap.Context, dir string, opts checkoutOptions) error {
+	if opts.open {
+		return openDirectory(ctx, dir)
+	}
+	fmt.Fprintf(ctx.Stdout(), "cd %s\n", shellQuote(dir))
+	return nil
+}
+
+// worktreeDir is where a worktree for branch goes: <repo>.worktrees/<branch>
+// beside the main checkout, with slashes in the branch flattened.
+func worktreeDir(worktrees []gitWorktree, branch string) (string, error) {
+	root := ""
+	for _, wt := range worktrees {
+		if wt.main {
+			root = wt.path
+		}
+	}
+	if root == "" {
+		return "", fmt.Errorf("could not find the main worktree")
+	}
+	dir := filepath.Join(root+".worktrees", strings.ReplaceAll(branch, "/", "-"))
+	if _, err := os.Stat(dir); err == nil {
+		return "", fmt.Errorf("%s already exists; remove it or run %s worktree prune", dir, commandName)
+	}
+	return dir, nil
+}
+
+// listWorktrees parses git worktree list; the main worktree comes first.
+func listWorktrees() ([]gitWorktree, error) {
+	out, err := gitOutput("worktree", "list", "--porcelain")
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		worktrees []gitWorktree
+		current   *gitWorktree
+	)
+	for _, line := range strings.Split(out, "\n") {
+		key, value, _ := strings.Cut(strings.TrimSpace(line), " ")
+		switch key {
+		case "worktree":
+			worktrees = append(worktrees, gitWorktree{path: value, main: len(worktrees) == 0})
+			current = &worktrees[len(worktrees)-1]
+		case "HEAD":
+			if current != nil {
+				current.head = value
+			}
+		case "branch":
+			if current != nil {
+				current.branch = strings.TrimPrefix(value, "refs/heads/")
+			}
+		case "prunable":
+			if current != nil {
+				current.prunable = true
+			}
+		}
+	}
+	return worktrees, nil
+}
+
+func runWorktree(ctx *snap.Context) error {
+	usage := fmt.Sprintf("Usage: %s worktree list | open [branch] | remove [branch] [--force] | prune [--dry-run] [--yes]", commandName)
+
+	var args []string
+	for i := 0; i < ctx.NArgs(); i++ {
+		if arg := strings.TrimSpace(ctx.Arg(i)); arg != "" {
+			args = append(args, arg)
+		}
+	}
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+
+	if err := ensureGitRepository(); err != nil {
+		return reportError(ctx, err)
+	}
+
+	sub, rest := args[0], args[1:]
+	var (
+		target string
+		force  bool
+		dryRun bool
+		yes    bool
+	)
+	for _, arg := range rest {
+		switch {
+		case arg == "--force" && sub == "remove":
+			force = true
+		case arg == "--dry-run" && sub == "prune":
+			dryRun = true
+		case (arg == "--yes" || arg == "-y") && sub == "prune":
+			yes = true
+		case target == "" && !strings.HasPrefix(arg, "-") && (sub == "open" || sub == "remove"):
+			target = arg
+		default:
+			fmt.Fprintln(ctx.Stderr(), usage)
+			return fmt.Errorf("unexpected argument %q", arg)
+		}
+	}
+
+	switch sub {
+	case "list", "ls":
+		return listWorktreesCommand(ctx)
+	case "open":
+		wt, err := selectWorktree(target)
+		if err != nil || wt == nil {
+			return reportError(ctx, err)
+		}
+		return reportError(ctx, openDirectory(ctx, wt.path))
+	case "remove", "rm":
+		wt, err := selectWorktree(target)
+		if err != nil || wt == nil {
+			return reportError(ctx, err)
+		}
+		removeArgs := []string{"worktree", "remove"}
+		if force {
+			removeArgs = append(removeArgs, "--force")
+		}
+		if err := runGitCommandStreaming(ctx, append(removeArgs, wt.path)...); err != nil {
+			return reportError(ctx, fmt.Errorf("git worktree remove %s: %w (uncommitted changes? pass --force)", wt.path, err))
+		}
+		fmt.Fprintf(ctx.Stdout(), "✔️ Removed worktree %s\n", wt.path)
+		return nil
+	case "prune":
+		return pruneWorktrees(ctx, dryRun, yes)
+	default:
+		fmt.Fprintln(ctx.Stderr(), usage)
+		return fmt.Errorf("unknown worktree command %q", sub)
+	}
+}
+
+func listWorktreesCommand(ctx *snap.Context) error {
+	worktrees, err := listWorktrees()
+	if err != nil {
+		return reportError(ctx, err)
+	}
+	merged, gone := branchCleanupState()
+	for _, wt := range worktrees {
+		name := wt.branch
+		if name == "" {
+			name = "(detached " + shortSHA(wt.head) + ")"
+		}
+		var notes []string
+		if wt.main {
+			notes = append(notes, "main")
+		}
+		if wt.prunable {
+			notes = append(notes, "missing")
+		}
+		if _, ok := merged[wt.branch]; ok && !wt.main {
+			notes = append(notes, "merged")
+		}
+		if _, ok := gone[wt.branch]; ok {
+			notes = append(notes, "upstream gone")
+		}
+		status := ""
+		if len(notes) > 0 {
+			status = " [" + strings.Join(notes, ", ") + "]"
+		}
+		fmt.Fprintf(ctx.Stdout(), "%-30s %s%s\n", name, wt.path, status)
+	}
+	return nil
+}
+
+// selectWorktree finds the linked worktree for branch, or lets the user pick
+// one. It returns nil when the picker is aborted.
+func selectWorktree(branch string) (*gitWorktree, error) {
+	worktrees, err := listWorktrees()
+	if err != nil {
+		return nil, err
+	}
+	var linked []gitWorktree
+	for _, wt := range worktrees {
+		if !wt.main {
+			linked = append(linked, wt)
+		}
+	}
+	if len(linked) == 0 {
+		return nil, fmt.Errorf("no linked worktrees; create one with %s gitCheckout --worktree <branch>", commandName)
+	}
+
+	if branch != "" {
+		for i, wt := range linked {
+			if wt.branch == branch || wt.path == branch || filepath.Base(wt.path) == branch {
+				return &linked[i], nil
+			}
+		}
+		return nil, fmt.Errorf("no worktree for %q", branch)
+	}
+
+	idx, err := fuzzyfinder.Find(
+		linked,
+		func(i int) string {
+			if linked[i].branch == "" {
+				return filepath.Base(linked[i].path)
+			}
+			return linked[i].branch
+		},
+		fuzzyfinder.WithPromptString("worktree> "),
+		fuzzyfinder.WithPreviewWindow(func(i, width, height int) string {
+			if i < 0 {
+				return ""
+			}
+			wt := linked[i]
+			preview := wt.path + "\n"
+			if log, err := gitOutput("-C", wt.path, "log", "-1", "--format=%h %s%n%an, %cr"); err == nil {
+				preview += "\n" + log
+			}
+			if status, err := gitOutput("-C", wt.path, "status", "--short"); err == nil && strings.TrimSpace(status) != "" {
+				preview += "\nUncommitted changes:\n" + status
+			}
+			return preview
+		}),
+	)
+	if err != nil {
+		if errors.Is(err, fuzzyfinder.ErrAbort) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("select worktree: %w", err)
+	}
+	return &linked[idx], nil
+}
+
+// pruneWorktrees drops stale worktree entries and removes worktrees whose
+// branch was merged into the default branch, or lost its upstream after being
+// squash-merged. Worktrees with uncommitted changes or unmerged commits are
+// kept.
+func pruneWorktrees(ctx *snap.Context, dryRun, assumeYes bool) error {
+	if !dryRun {
+		if err := runGitCommandStreaming(ctx, "worktree", "prune", "--verbose"); err != nil {
+			return reportError(ctx, fmt.Errorf("git worktree prune: %w", err))
+		}
+	}
+
+	worktrees, err := listWorktrees()
+	if err != nil {
+		return reportError(ctx, err)
+	}
+	merged, gone := branchCleanupState()
+	base := pickerBaseRef()
+	cwd, _ := os.Getwd()
+
+	type candidate struct {
+		wt     gitWorktree
+		reason string
+	}
+	var candidates []candidate
+	for _, wt := range worktrees {
+		if wt.main || wt.branch == "" || wt.prunable {
+			continue
+		}
+		reason := ""
+		if _, ok := merged[wt.branch]; ok {
+			reason = "merged"
+		} else if _, ok := gone[wt.branch]; ok {
+			// A deleted upstream alone does not mean the work landed.
+			if base == "" || !squashMerged(base, wt.branch) {
+				fmt.Fprintf(ctx.Stderr(), "ℹ️ Skipping %s: its upstream is gone but it has commits not on the default branch\n", wt.path)
+				continue
+			}
+			reason = "squash-merged"
+		} else {
+			continue
+		}
+		if rel, err := filepath.Rel(wt.path, cwd); err == nil && !strings.HasPrefix(rel, "..") {
+			fmt.Fprintf(ctx.Stderr(), "ℹ️ Skipping %s: it is the current directory\n", wt.path)
+			continue
+		}
+		if status, err := gitOutput("-C", wt.path, "status", "--porcelain"); err != nil || strings.TrimSpace(status) != "" {
+			fmt.Fprintf(ctx.Stderr(), "ℹ️ Skipping %s: it has uncommitted changes\n", wt.path)
+			continue
+		}
+		candidates = append(candidates, candidate{wt: wt, reason: reason})
+	}
+
+	if len(candidates) == 0 {
+		fmt.Fprintln(ctx.Stdout(), "No worktrees to clean up.")
+		return nil
+	}
+	for _, c := range candidates {
+		fmt.Fprintf(ctx.Stdout(), "  %-30s %s (%s)\n", c.wt.branch, c.wt.path, c.reason)
+	}
+	if dryRun {
+		fmt.Fprintln(ctx.Stdout(), "Dry run; nothing was removed.")
+		return nil
+	}
+	if !assumeYes {
+		fmt.Fprintf(ctx.Stdout(), "Remove these %d worktrees and their branches? [y/n]: ", len(candidates))
+		choice, err := readConfirmationChoice(ctx)
+		fmt.Fprintln(ctx.Stdout())
+		if err != nil {
+			return reportError(ctx, fmt.Errorf("reading choice: %w", err))
+		}
+		if strings.ToLower(string(choice)) != "y" {
+			fmt.Fprintln(ctx.Stdout(), "Prune cancelled.")
+			return nil
+		}
+	}
+
+	for _, c := range candidates {
+		if err := runGitCommandStreaming(ctx, "worktree", "remove", c.wt.path); err != nil {
+			fmt.Fprintf(ctx.Stderr(), "⚠️ git worktree remove %s: %v\n", c.wt.path, err)
+			continue
+		}
+		// Both reasons were checked against the default branch, which
+		// branch -d does not look at, and it cannot see squash merges.
+		if err := runGitCommandStreaming(ctx, "branch", "-D", c.wt.branch); err != nil {
+			fmt.Fprintf(ctx.Stderr(), "⚠️ git branch -D %s: %v\n", c.wt.branch, err)
+			continue
+		}
+		fmt.Fprintf(ctx.Stdout(), "✔️ Removed %s (%s)\n", c.wt.branch, c.reason)
+	}
+	return nil
+}
+
+// branchCleanupState returns the local branches merged into the default
+// branch and those whose upstream branch no longer exists.
+func branchCleanupState() (map[string]struct{}, map[string]struct{}) {
+	merged := map[string]struct{}{}
+	gone := map[string]struct{}{}
+
+	base := pickerBaseRef()
+	if base != "" {
+		if out, err := gitOutput("branch", "--merged", base, "--format=%(refname:short)"); err == nil {
+			for _, name := range strings.Fields(out) {
+				merged[name] = struct{}{}
+			}
+		}
+		// The default branch itself is always merged into its own remote copy.
+		delete(merged, strings.TrimPrefix(base, "origin/"))
+	}
+
+	if out, err := gitOutput("for-each-ref", "--format=%(refname:short) %(upstream:track)", "refs/heads"); err == nil {
+		for _, line := range strings.Split(out, "\n") {
+			name, track, _ := strings.Cut(strings.TrimSpace(line), " ")
+			if strings.Contains(track, "gone") {
+				gone[name] = struct{}{}
+			}
+		}
+	}
+	return merged, gone
+}
+
+// openDirectory opens dir in Cursor when it is installed and in the
+// configured editor otherwise.
+func openDirectory(ctx *snap.Context, dir string) error {
+	if err := openInCursor(ctx, dir); err == nil {
+		return nil
+	}
+	fields := strings.Fields(findEditor())
+	cmd := exec.Command(fields[0], append(fields[1:], dir)...)
+	cmd.Dir = dir
+	cmd.Stdout = ctx.Stdout()
+	cmd.Stderr = ctx.Stderr()
+	cmd.Stdin = ctx.Stdin()
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("open %s in %s: %w", dir, fields[0], err)
+	}
+	return nil
+}
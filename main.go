@@ -116,34 +116,10 @@ func main() {
 
 	app.Command("checkoutPR", "Checkout a GitHub pull request by URL or number").
 		Action(func(ctx *snap.Context) error {
-			if ctx.NArgs() != 1 {
-				fmt.Fprintf(ctx.Stderr(), "Usage: %s checkoutPR <github-pr-url-or-number>\n", flowName)
-				return fmt.Errorf("expected 1 argument, got %d", ctx.NArgs())
-			}
-
-			input := strings.TrimSpace(ctx.Arg(0))
-			if input == "" {
-				fmt.Fprintf(ctx.Stderr(), "Usage: %s checkoutPR <github-pr-url-or-number>\n", flowName)
-				return fmt.Errorf("pull request reference cannot be empty")
-			}
-
-			prNumber, err := extractPullRequestNumber(input)
-			if err != nil {
+			if err := runCheckoutPR(ctx); err != nil {
+				fmt.Fprintln(ctx.Stderr(), err)
 				return err
 			}
-
-			if _, err := exec.LookPath("gh"); err != nil {
-				return fmt.Errorf("gh CLI not found in PATH: %w", err)
-			}
-
-			cmd := exec.Command("gh", "pr", "checkout", strconv.Itoa(prNumber))
-			cmd.Stdout = ctx.Stdout()
-			cmd.Stderr = ctx.Stderr()
-			cmd.Stdin = ctx.Stdin()
-			if err := cmd.Run(); err != nil {
-				return fmt.Errorf("gh pr checkout %d: %w", prNumber, err)
-			}
-
 			return nil
 		})
 
@@ -158,6 +134,11 @@ func main() {
 		return
 	}
 
+	// checkoutPR parses its own flags.
+	if len(os.Args) > 2 && os.Args[1] == "checkoutPR" && os.Args[2] != "--" {
+		os.Args = append([]string{os.Args[0], os.Args[1], "--"}, os.Args[2:]...)
+	}
+
 	app.RunAndExit()
 }
 
@@ -209,7 +190,13 @@ func printCommandHelp(name string, out io.Writer) bool {
 		fmt.Fprintln(out, "Checkout a GitHub pull request by URL or number")
 		fmt.Fprintln(out)
 		fmt.Fprintln(out, "Usage:")
-		fmt.Fprintln(out, "  flow checkoutPR <github-pr-url-or-number>")
+		fmt.Fprintln(out, "  flow checkoutPR <github-pr-url-or-number> [--merge-ref] [--force] [--worktree [--open]]")
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "Fetches refs/pull/<n>/head from the remote matching the URL's repository (upstream, then")
+		fmt.Fprintln(out, "origin, for a bare number) into pr/<n>. Run it again to fast-forward to new commits; --force")
+		fmt.Fprintln(out, "resets after a force-push. --merge-ref checks out GitHub's test merge as pr/<n>-merge instead;")
+		fmt.Fprintln(out, "GitHub rebuilds that merge as the branches move, so each run resets pr/<n>-merge to the latest.")
+		fmt.Fprintln(out, "--worktree checks the branch out in <repo>.worktrees/pr-<n> instead; --open opens it in your editor.")
 		return true
 	case "killPort":
 		fmt.Fprintln(out, "Kill a process by the port it listens on, optionally with fuzzy finder")
@@ -377,15 +364,17 @@ func uniqueByPID(processes []listeningProcess) []listeningProcess {
 	return unique
 }
 
-func extractPullRequestNumber(input string) (int, error) {
+// extractPullRequestNumber returns the pull request number in input and, for
+// a URL, the owner/repo it belongs to.
+func extractPullRequestNumber(input string) (int, string, error) {
 	candidate := strings.TrimSpace(input)
 	candidate = strings.TrimSuffix(candidate, "/")
 	if candidate == "" {
-		return 0, fmt.Errorf("pull request reference cannot be empty")
+		return 0, "", fmt.Errorf("pull request reference cannot be empty")
 	}
 
 	if number, ok := parseNumericCandidate(candidate); ok {
-		return number, nil
+		return number, "", nil
 	}
 
 	if strings.HasPrefix(candidate, "http://") || strings.HasPrefix(candidate, "https://") {
@@ -397,7 +386,11 @@ func extractPullRequestNumber(input string) (int, error) {
 				if segment == "pull" || segment == "pulls" {
 					if i+1 < len(segments) {
 						if number, ok := parseNumericCandidate(segments[i+1]); ok {
-							return number, nil
+							repo := ""
+							if i >= 2 {
+								repo = segments[i-2] + "/" + segments[i-1]
+							}
+							return number, repo, nil
 						}
 					}
 				}
@@ -407,17 +400,38 @@ func extractPullRequestNumber(input string) (int, error) {
 
 	if idx := strings.LastIndex(candidate, "#"); idx >= 0 && idx+1 < len(candidate) {
 		if number, ok := parseNumericCandidate(candidate[idx+1:]); ok {
-			return number, nil
+			repo := strings.Trim(candidate[:idx], "/ ")
+			if !isOwnerRepo(repo) {
+				repo = ""
+			}
+			return number, repo, nil
 		}
 	}
 
 	if idx := strings.LastIndex(candidate, "/"); idx >= 0 && idx+1 < len(candidate) {
 		if number, ok := parseNumericCandidate(candidate[idx+1:]); ok {
-			return number, nil
+			return number, "", nil
 		}
 	}
 
-	return 0, fmt.Errorf("unable to determine pull request number from %q", input)
+	return 0, "", fmt.Errorf("unable to determine pull request number from %q", input)
+}
+
+// isOwnerRepo reports whether s looks like a GitHub owner/repo pair, so text
+// such as "PR" in "PR #12" is not taken for a repository.
+func isOwnerRepo(s string) bool {
+	owner, repo, ok := strings.Cut(s, "/")
+	if !ok || owner == "" || repo == "" {
+		return false
+	}
+	for _, r := range owner + repo {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+		default:
+			return false
+		}
+	}
+	return true
 }
 
 func parseNumericCandidate(raw string) (int, bool) {
@@ -438,3 +452,282 @@ func parseNumericCandidate(raw string) (int, bool) {
 	}
 	return number, true
 }
+
+func runCheckoutPR(ctx *snap.Context) error {
+	usage := fmt.Sprintf("Usage: %s checkoutPR <github-pr-url-or-number> [--merge-ref] [--force] [--worktree [--open]]", flowName)
+
+	var (
+		input    string
+		mergeRef bool
+		force    bool
+		worktree bool
+		open     bool
+	)
+	for i := 0; i < ctx.NArgs(); i++ {
+		arg := strings.TrimSpace(ctx.Arg(i))
+		switch {
+		case arg == "":
+		case arg == "--merge-ref":
+			mergeRef = true
+		case arg == "--force":
+			force = true
+		case arg == "--worktree":
+			worktree = true
+		case arg == "--open":
+			open = true
+		case strings.HasPrefix(arg, "--"):
+			fmt.Fprintln(ctx.Stderr(), usage)
+			return fmt.Errorf("unknown flag %q", arg)
+		case input == "":
+			input = arg
+		default:
+			fmt.Fprintln(ctx.Stderr(), usage)
+			return fmt.Errorf("unexpected argument %q", arg)
+		}
+	}
+	if input == "" {
+		fmt.Fprintln(ctx.Stderr(), usage)
+		return fmt.Errorf("pull request reference cannot be empty")
+	}
+	if open && !worktree {
+		fmt.Fprintln(ctx.Stderr(), usage)
+		return fmt.Errorf("--open requires --worktree")
+	}
+
+	prNumber, repo, err := extractPullRequestNumber(input)
+	if err != nil {
+		return err
+	}
+
+	remote, err := pullRequestRemote(repo)
+	if err != nil {
+		return err
+	}
+
+	source := fmt.Sprintf("refs/pull/%d/head", prNumber)
+	branch := fmt.Sprintf("pr/%d", prNumber)
+	if mergeRef {
+		source = fmt.Sprintf("refs/pull/%d/merge", prNumber)
+		branch = fmt.Sprintf("pr/%d-merge", prNumber)
+	}
+
+	if err := runGit(ctx, "fetch", remote, source); err != nil {
+		if mergeRef {
+			return fmt.Errorf("git fetch %s %s: %w (GitHub has no merge ref for closed or conflicting pull requests)", remote, source, err)
+		}
+		return fmt.Errorf("git fetch %s %s: %w", remote, source, err)
+	}
+	fetched, err := gitOutput("rev-parse", "FETCH_HEAD")
+	if err != nil {
+		return err
+	}
+
+	exists := exec.Command("git", "rev-parse", "--verify", "--quiet", "refs/heads/"+branch).Run() == nil
+
+	// dir is the worktree the branch is refreshed in; "" is the current one.
+	dir := ""
+	if worktree {
+		dir, err = branchWorktree(branch)
+		if err != nil {
+			return err
+		}
+		if dir == "" {
+			if dir, err = newWorktreeDir(branch); err != nil {
+				return err
+			}
+			args := []string{"worktree", "add", dir, branch}
+			if !exists {
+				args = []string{"worktree", "add", "-b", branch, dir, fetched}
+			}
+			if err := runGit(ctx, args...); err != nil {
+				return fmt.Errorf("git worktree add %s: %w", dir, err)
+			}
+		}
+	} else if !exists {
+		if err := runGit(ctx, "checkout", "-b", branch, fetched); err != nil {
+			return fmt.Errorf("git checkout -b %s: %w", branch, err)
+		}
+	}
+	if !exists {
+		// Tracking the pull ref lets plain git pull refresh the branch too.
+		_ = exec.Command("git", "config", "branch."+branch+".remote", remote).Run()
+		_ = exec.Command("git", "config", "branch."+branch+".merge", source).Run()
+		fmt.Fprintf(ctx.Stdout(), "Checked out #%d from %s as %s at %s\n", prNumber, remote, branch, fetched[:7])
+		return finishPRWorktree(ctx, dir, open)
+	}
+
+	in := func(args ...string) []string {
+		if dir == "" {
+			return args
+		}
+		return append([]string{"-C", dir}, args...)
+	}
+
+	if !worktree {
+		current, _ := gitOutput("rev-parse", "--abbrev-ref", "HEAD")
+		if current != branch {
+			if err := runGit(ctx, "checkout", branch); err != nil {
+				return fmt.Errorf("git checkout %s: %w", branch, err)
+			}
+		}
+	}
+
+	head, err := gitOutput(in("rev-parse", "HEAD")...)
+	if err != nil {
+		return err
+	}
+	switch {
+	case head == fetched:
+		fmt.Fprintf(ctx.Stdout(), "%s is up to date with #%d\n", branch, prNumber)
+	case exec.Command("git", "merge-base", "--is-ancestor", head, fetched).Run() == nil:
+		if err := runGit(ctx, in("merge", "--ff-only", fetched)...); err != nil {
+			return fmt.Errorf("git merge --ff-only: %w", err)
+		}
+		fmt.Fprintf(ctx.Stdout(), "Refreshed %s to %s\n", branch, fetched[:7])
+	case !force && !mergeRef:
+		return fmt.Errorf("%s has diverged from #%d (force-pushed, or local commits); rerun with --force to reset it to %s", branch, prNumber, fetched[:7])
+	default:
+		// GitHub recreates the merge ref whenever the pull request or its base
+		// moves, so a merge-ref branch never fast-forwards and is always reset.
+		// --keep refuses to reset over uncommitted changes to the same files.
+		if err := runGit(ctx, in("reset", "--keep", fetched)...); err != nil {
+			return fmt.Errorf("git reset --keep %s: %w", fetched[:7], err)
+		}
+		fmt.Fprintf(ctx.Stdout(), "Reset %s to %s\n", branch, fetched[:7])
+	}
+	return finishPRWorktree(ctx, dir, open)
+}
+
+// branchWorktree returns the worktree branch is checked out in, if any.
+func branchWorktree(branch string) (string, error) {
+	out, err := gitOutput("worktree", "list", "--porcelain")
+	if err != nil {
+		return "", err
+	}
+	path := ""
+	for _, line := range strings.Split(out, "\n") {
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "worktree":
+			path = value
+		case "branch":
+			if value == "refs/heads/"+branch {
+				return path, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// newWorktreeDir returns <repo>.worktrees/<branch> beside the main worktree,
+// with slashes in the branch flattened.
+func newWorktreeDir(branch string) (string, error) {
+	out, err := gitOutput("worktree", "list", "--porcelain")
+	if err != nil {
+		return "", err
+	}
+	first, _, _ := strings.Cut(out, "\n")
+	root := strings.TrimPrefix(first, "worktree ")
+	dir := filepath.Join(root+".worktrees", strings.ReplaceAll(branch, "/", "-"))
+	if _, err := os.Stat(dir); err == nil {
+		return "", fmt.Errorf("%s already exists; remove it first", dir)
+	}
+	return dir, nil
+}
+
+func finishPRWorktree(ctx *snap.Context, dir string, open bool) error {
+	if dir == "" {
+		return nil
+	}
+	if !open {
+		fmt.Fprintf(ctx.Stdout(), "Worktree: %s\n", dir)
+		return nil
+	}
+	editor := "cursor"
+	for _, env := range []string{"VISUAL", "EDITOR"} {
+		if val := strings.TrimSpace(os.Getenv(env)); val != "" {
+			editor = val
+			break
+		}
+	}
+	fields := strings.Fields(editor)
+	cmd := exec.Command(fields[0], append(fields[1:], dir)...)
+	cmd.Stdout = ctx.Stdout()
+	cmd.Stderr = ctx.Stderr()
+	cmd.Stdin = ctx.Stdin()
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("open %s in %s: %w", dir, fields[0], err)
+	}
+	return nil
+}
+
+// pullRequestRemote picks the remote pointing at repo (owner/repo). Without a
+// repo it prefers upstream, where a fork's pull requests live, then origin.
+func pullRequestRemote(repo string) (string, error) {
+	out, err := gitOutput("remote")
+	if err != nil {
+		return "", err
+	}
+	remotes := strings.Fields(out)
+	if len(remotes) == 0 {
+		return "", fmt.Errorf("no git remotes configured")
+	}
+
+	if repo == "" {
+		for _, preferred := range []string{"upstream", "origin"} {
+			for _, name := range remotes {
+				if name == preferred {
+					return name, nil
+				}
+			}
+		}
+		return remotes[0], nil
+	}
+
+	for _, name := range remotes {
+		remoteURL, err := gitOutput("remote", "get-url", name)
+		if err != nil {
+			continue
+		}
+		if strings.EqualFold(githubRepoPath(remoteURL), repo) {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("no remote points at github.com/%s; add one with git remote add", repo)
+}
+
+// githubRepoPath returns owner/repo for a GitHub ssh or https remote URL.
+func githubRepoPath(remoteURL string) string {
+	trimmed := strings.TrimSuffix(strings.TrimSuffix(strings.TrimSpace(remoteURL), "/"), ".git")
+	switch {
+	case strings.HasPrefix(trimmed, "git@github.com:"):
+		return strings.TrimPrefix(trimmed, "git@github.com:")
+	case strings.Contains(trimmed, "://"):
+		u, err := url.Parse(trimmed)
+		if err != nil || !strings.EqualFold(strings.TrimPrefix(u.Hostname(), "www."), "github.com") {
+			return ""
+		}
+		return strings.Trim(u.Path, "/")
+	}
+	return ""
+}
+
+func gitOutput(args ...string) (string, error) {
+	out, err := exec.Command("git", args...).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return "", fmt.Errorf("git %s: %s", strings.Join(args, " "), strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", fmt.Errorf("git %s: %w", strings.Join(args, " "), err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func runGit(ctx *snap.Context, args ...string) error {
+	cmd := exec.Command("git", args...)
+	cmd.Stdout = ctx.Stdout()
+	cmd.Stderr = ctx.Stderr()
+	cmd.Stdin = ctx.Stdin()
+	return cmd.Run()
+}